@@ -0,0 +1,155 @@
+package cosmo
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/hwcer/cosgo/schema"
+	"github.com/hwcer/cosmo/update"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// autoTimeValue 按字段类型生成时间,支持 time.Time 和整数(unix 秒)
+func autoTimeValue(field *schema.Field, now time.Time) (any, bool) {
+	if field.IndirectFieldType == timeType {
+		return now, true
+	}
+	switch field.IndirectFieldType.Kind() {
+	case reflect.Int, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+		return now.Unix(), true
+	}
+	return nil, false
+}
+
+// softDeleteValue 软删除标记值,bool 类型为 true,时间类型为 now
+func softDeleteValue(field *schema.Field, now time.Time) (any, bool) {
+	if field.IndirectFieldType.Kind() == reflect.Bool {
+		return true, true
+	}
+	return autoTimeValue(field, now)
+}
+
+// setAutoTime 字段为零值时写入当前时间
+func setAutoTime(field *schema.Field, rv reflect.Value, now time.Time) {
+	if v := field.Get(rv); v.IsValid() && v.IsZero() {
+		assignTime(v, now)
+	}
+}
+
+// assignTime 将当前时间写入时间或整数类型的字段
+func assignTime(v reflect.Value, now time.Time) {
+	if !v.CanSet() {
+		return
+	}
+	if v.Kind() == reflect.Ptr {
+		v.Set(reflect.New(v.Type().Elem()))
+		v = v.Elem()
+	}
+	if v.Type() == timeType {
+		v.Set(reflect.ValueOf(now))
+		return
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		v.SetInt(now.Unix())
+	case reflect.Uint, reflect.Uint32, reflect.Uint64:
+		v.SetUint(uint64(now.Unix()))
+	}
+}
+
+// autoTimeFields 创建时需要自动写入时间的字段
+func autoTimeFields(sch *schema.Schema) (fields []*schema.Field) {
+	for _, k := range []string{TagAutoCreateTime, TagAutoUpdateTime} {
+		if field := LookUpTagField(sch, k); field != nil {
+			if _, ok := autoTimeValue(field, time.Time{}); ok {
+				fields = append(fields, field)
+			}
+		}
+	}
+	return
+}
+
+// autoCreateTime 创建文档时写入 autoCreateTime,autoUpdateTime 字段,不覆盖已经设置的值
+func autoCreateTime(stmt *Statement) {
+	fields := autoTimeFields(stmt.schema)
+	if len(fields) == 0 {
+		return
+	}
+	now := stmt.now()
+	setStruct := func(rv reflect.Value) {
+		rv = reflect.Indirect(rv)
+		if rv.Kind() != reflect.Struct || rv.Type() != stmt.schema.ModelType {
+			return
+		}
+		for _, field := range fields {
+			setAutoTime(field, rv, now)
+		}
+	}
+	rv := stmt.reflectValue
+	switch rv.Kind() {
+	case reflect.Struct:
+		setStruct(rv)
+	case reflect.Array, reflect.Slice:
+		for i := 0; i < rv.Len(); i++ {
+			setStruct(rv.Index(i))
+		}
+	case reflect.Map:
+		if rv.IsNil() || rv.Type().Key().Kind() != reflect.String || rv.Type().Elem().Kind() != reflect.Interface {
+			return
+		}
+		for _, field := range fields {
+			k := reflect.ValueOf(field.DBName)
+			if rv.MapIndex(k).IsValid() {
+				continue
+			}
+			v, _ := autoTimeValue(field, now)
+			rv.SetMapIndex(k, reflect.ValueOf(v))
+		}
+	}
+}
+
+// autoUpdateTime 更新时使用 $set 写入 autoUpdateTime 字段,upsert 时使用 $setOnInsert 写入 autoCreateTime 字段
+// map,update.Update 中已经包含该字段时不覆盖
+// struct 中的时间通常是查询时的旧值,除非使用 Select 明确指定,否则总是使用当前时间,使用 Omit 忽略时不写入
+func autoUpdateTime(stmt *Statement, data update.Update, upsert bool) {
+	now := stmt.now()
+	isStruct := stmt.reflectValue.Kind() == reflect.Struct
+	var projection map[string]bool
+	if isStruct {
+		projection = stmt.selector.Projection(stmt.schema)
+	}
+	if field := LookUpTagField(stmt.schema, TagAutoUpdateTime); field != nil {
+		v, ok := autoTimeValue(field, now)
+		if selected, exist := projection[field.DBName]; exist && (!selected || hasUpdateField(data, field.DBName)) {
+			ok = false
+		} else if !isStruct && hasUpdateField(data, field.DBName) {
+			ok = false
+		}
+		if ok {
+			data.Remove(update.UpdateTypeSetOnInsert, field.DBName)
+			data.Set(field.DBName, v)
+			if isStruct && stmt.reflectValue.Type() == stmt.schema.ModelType {
+				assignTime(field.Get(stmt.reflectValue), now)
+			}
+		}
+	}
+	if !upsert {
+		return
+	}
+	if field := LookUpTagField(stmt.schema, TagAutoCreateTime); field != nil && !hasUpdateField(data, field.DBName) {
+		if v, ok := autoTimeValue(field, now); ok {
+			data.SetOnInert(field.DBName, v)
+		}
+	}
+}
+
+// hasUpdateField 任意更新操作中是否包含字段k
+func hasUpdateField(data update.Update, k string) bool {
+	for _, m := range data {
+		if _, ok := m[k]; ok {
+			return true
+		}
+	}
+	return false
+}
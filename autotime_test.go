@@ -0,0 +1,182 @@
+package cosmo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hwcer/cosmo/update"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type testAutoTime struct {
+	Id      int       `bson:"_id"`
+	Name    string    `bson:"name"`
+	Created int64     `bson:"created" cosmo:"autoCreateTime"`
+	Updated time.Time `bson:"updated" cosmo:"autoUpdateTime"`
+}
+
+type testAutoUnix struct {
+	Id      int       `bson:"_id"`
+	Name    string    `bson:"name"`
+	Created time.Time `bson:"created" cosmo:"autoCreateTime"`
+	Updated int64     `bson:"updated" cosmo:"autoUpdateTime"`
+}
+
+// buildUpdate 模拟 cmdUpdate 生成更新语句
+func buildUpdate(t *testing.T, tx *DB, upsert bool) update.Update {
+	if tx = tx.statement.Parse(); tx.Error != nil {
+		t.Fatal(tx.Error)
+	}
+	stmt := tx.statement
+	data, _, err := update.Build(stmt.value, stmt.schema, &stmt.selector)
+	if err != nil {
+		t.Fatal(err)
+	}
+	autoUpdateTime(stmt, data, upsert)
+	return data
+}
+
+func TestAutoCreateTime(t *testing.T) {
+	db := New()
+	explicit := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	rows := []*testAutoTime{{Id: 1}, {Id: 2, Created: 100, Updated: explicit}}
+	tx := db.Model(&testAutoTime{})
+	tx.statement.value = &rows
+	if tx = tx.statement.Parse(); tx.Error != nil {
+		t.Fatal(tx.Error)
+	}
+	autoCreateTime(tx.statement)
+	if rows[0].Created == 0 || rows[0].Updated.IsZero() {
+		t.Fatalf("autoCreateTime not set:%+v", rows[0])
+	}
+	if rows[1].Created != 100 || !rows[1].Updated.Equal(explicit) {
+		t.Fatalf("autoCreateTime overwrite explicit value:%+v", rows[1])
+	}
+
+	unix := &testAutoUnix{Id: 3}
+	tx = db.Model(unix)
+	tx.statement.value = unix
+	if tx = tx.statement.Parse(); tx.Error != nil {
+		t.Fatal(tx.Error)
+	}
+	autoCreateTime(tx.statement)
+	if unix.Created.IsZero() || unix.Updated == 0 {
+		t.Fatalf("autoCreateTime not set:%+v", unix)
+	}
+
+	m := bson.M{"_id": 4, "created": int64(1)}
+	tx = db.Model(&testAutoTime{})
+	tx.statement.value = m
+	if tx = tx.statement.Parse(); tx.Error != nil {
+		t.Fatal(tx.Error)
+	}
+	autoCreateTime(tx.statement)
+	if m["created"] != int64(1) {
+		t.Fatalf("autoCreateTime overwrite map value:%v", m)
+	}
+	if _, ok := m["updated"].(time.Time); !ok {
+		t.Fatalf("autoCreateTime not set on map:%v", m)
+	}
+}
+
+func TestAutoUpdateTime(t *testing.T) {
+	db := New()
+	old := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	//struct 中的旧时间被刷新
+	v := &testAutoTime{Id: 1, Name: "a", Updated: old}
+	tx := db.Model(v)
+	tx.statement.value = v
+	data := buildUpdate(t, tx, false)
+	if u, ok := data.Get(update.UpdateTypeSet, "updated"); !ok || !u.(time.Time).After(old) || !v.Updated.After(old) {
+		t.Fatalf("struct update time error:%v", data)
+	}
+	//map 中明确指定时不覆盖
+	tx = db.Model(&testAutoTime{})
+	tx.statement.value = bson.M{"name": "b", "updated": old}
+	if u, _ := buildUpdate(t, tx, false).Get(update.UpdateTypeSet, "updated"); u != old {
+		t.Fatalf("map update time overwrite:%v", u)
+	}
+	//int64 字段,update.Update 更新
+	up := update.New()
+	up.Set("name", "c")
+	tx = db.Model(&testAutoUnix{})
+	tx.statement.value = up
+	data = buildUpdate(t, tx, true)
+	if u, ok := data.Get(update.UpdateTypeSet, "updated"); !ok || u.(int64) == 0 {
+		t.Fatalf("Update update time error:%v", data)
+	}
+	if c, ok := data.Get(update.UpdateTypeSetOnInsert, "created"); !ok || c.(time.Time).IsZero() {
+		t.Fatalf("upsert create time error:%v", data)
+	}
+	//Omit 忽略
+	tx = db.Model(&testAutoTime{}).Omit("Updated")
+	tx.statement.value = &testAutoTime{Name: "d"}
+	if data = buildUpdate(t, tx, false); hasUpdateField(data, "updated") {
+		t.Fatalf("omitted update time written:%v", data)
+	}
+}
+
+func TestAutoTimeDB(t *testing.T) {
+	db := newTestDB(t)
+	_, coll := db.Collection(&testAutoTime{})
+	if _, err := coll.DeleteMany(db.statement.Context, bson.M{}); err != nil {
+		t.Fatal(err)
+	}
+	v := &testAutoTime{Id: 1, Name: "a"}
+	if tx := db.Create(v); tx.Error != nil {
+		t.Fatal(tx.Error)
+	}
+	r := &testAutoTime{}
+	if tx := db.Find(r, 1); tx.Error != nil {
+		t.Fatal(tx.Error)
+	} else if r.Created == 0 || r.Updated.IsZero() {
+		t.Fatalf("create time not saved:%+v", r)
+	}
+	created := r.Created
+	updated := r.Updated
+	time.Sleep(10 * time.Millisecond)
+	if tx := db.Model(&testAutoTime{}).Update(bson.M{"name": "b"}, 1); tx.Error != nil {
+		t.Fatal(tx.Error)
+	}
+	if tx := db.Find(r, 1); tx.Error != nil {
+		t.Fatal(tx.Error)
+	} else if r.Created != created || !r.Updated.After(updated) {
+		t.Fatalf("update time not saved:%+v", r)
+	}
+}
+
+func TestNowTime(t *testing.T) {
+	fixed := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	db := New().Session(&Session{NowTime: func() time.Time { return fixed }})
+	row := &testAutoTime{Id: 1}
+	tx := db.Model(row)
+	tx.statement.value = row
+	if tx = tx.statement.Parse(); tx.Error != nil {
+		t.Fatal(tx.Error)
+	}
+	autoCreateTime(tx.statement)
+	if row.Created != fixed.Unix() || !row.Updated.Equal(fixed) {
+		t.Fatalf("autoCreateTime with NowTime error:%+v", row)
+	}
+	tx = db.Model(&testAutoTime{})
+	tx.statement.value = bson.M{"name": "x"}
+	if u, _ := buildUpdate(t, tx, false).Get(update.UpdateTypeSet, "updated"); u != fixed {
+		t.Fatalf("autoUpdateTime with NowTime error:%v", u)
+	}
+	//未设置时使用 time.Now
+	if now := New().statement.now(); time.Since(now) > time.Minute {
+		t.Fatalf("default now error:%v", now)
+	}
+	conn := newTestDB(t).Session(&Session{NowTime: func() time.Time { return fixed }})
+	_, coll := conn.Collection(&testAutoTime{})
+	if _, err := coll.DeleteMany(conn.statement.Context, bson.M{}); err != nil {
+		t.Fatal(err)
+	}
+	if tx = conn.Create(&testAutoTime{Id: 1}); tx.Error != nil {
+		t.Fatal(tx.Error)
+	}
+	stored := &testAutoTime{}
+	if tx = conn.Find(stored, 1); tx.Error != nil || stored.Created != fixed.Unix() || !stored.Updated.Equal(fixed) {
+		t.Fatalf("stored timestamp error:%v,%+v", tx.Error, stored)
+	}
+}
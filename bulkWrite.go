@@ -2,18 +2,23 @@ package cosmo
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"github.com/hwcer/cosmo/clause"
 	"github.com/hwcer/cosmo/update"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"sort"
 )
 
 type BulkWrite struct {
-	tx     *DB
-	opts   []*options.BulkWriteOptions
-	models []mongo.WriteModel
-	result *mongo.BulkWriteResult
-	filter BulkWriteUpdateFilter
+	size    int   //每批提交的数量,0 不分批
+	ordered *bool //是否顺序执行,覆盖 Options 中的设置
+	tx      *DB
+	opts    []*options.BulkWriteOptions
+	models  []mongo.WriteModel
+	result  *mongo.BulkWriteResult
+	filter  BulkWriteUpdateFilter
 }
 
 type ModelBulkWriteFilter interface {
@@ -26,6 +31,13 @@ func (this *BulkWrite) SetUpdateFilter(filter BulkWriteUpdateFilter) {
 	this.filter = filter
 }
 
+// WithContext 设置 Save 使用的 Context,默认使用 BulkWrite 创建时 DB 的 Context
+func (this *BulkWrite) WithContext(ctx context.Context) *BulkWrite {
+	this.tx.statement.Context = ctx
+	return this
+}
+
+// Save 提交所有操作,Context 已经取消时直接返回错误
 func (this *BulkWrite) Save() (err error) {
 	if this.tx.statement.Error != nil {
 		return this.tx.statement.Error
@@ -33,27 +45,94 @@ func (this *BulkWrite) Save() (err error) {
 	if len(this.models) == 0 {
 		return nil
 	}
-	if len(this.opts) == 0 {
-		ordered := false
-		this.opts = append(this.opts, &options.BulkWriteOptions{Ordered: &ordered})
+	ctx := this.tx.statement.Context
+	if ctx == nil {
+		ctx = context.Background()
 	}
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	opts := this.options()
+	ordered := options.MergeBulkWriteOptions(opts...).Ordered
 
 	tx := this.tx.callbacks.Call(this.tx, func(db *DB) error {
-		coll := db.client.Database(db.dbname).Collection(db.statement.table)
-		if this.result, err = coll.BulkWrite(context.Background(), this.models, this.opts...); err == nil {
-			this.models = nil
+		coll := db.statement.collection()
+		this.result = &mongo.BulkWriteResult{UpsertedIDs: map[int64]interface{}{}}
+		var saved int
+		for i, b := range createBatches(len(this.models), this.size) {
+			result, e := coll.BulkWrite(ctx, this.models[b[0]:b[1]], opts...)
+			if result != nil {
+				this.merge(result, b[0])
+			}
+			if e != nil {
+				//只保留失败和未执行的操作,修正后可以重新提交
+				this.models = append(failedModels(this.models[b[0]:b[1]], e, ordered), this.models[b[1]:]...)
+				if this.size > 0 {
+					return fmt.Errorf("bulk write batch %d error(%d models saved): %w", i, saved, e)
+				}
+				return e
+			}
+			saved = b[1]
 		}
-		return err
+		this.models = nil
+		return nil
 	})
 	err = tx.Error
 	return
 }
 
+// failedModels 失败批次中需要保留的操作
+// 顺序执行时保留失败的操作和之后未执行的操作,无序执行时只保留失败的操作
+// 无法确定执行情况的错误(网络错误,写关注错误等)保留整个批次
+func failedModels(models []mongo.WriteModel, err error, ordered *bool) []mongo.WriteModel {
+	var bwe mongo.BulkWriteException
+	if !errors.As(err, &bwe) || len(bwe.WriteErrors) == 0 || bwe.WriteConcernError != nil {
+		return models
+	}
+	index := make([]int, 0, len(bwe.WriteErrors))
+	for _, we := range bwe.WriteErrors {
+		if we.Index < 0 || we.Index >= len(models) {
+			return models
+		}
+		index = append(index, we.Index)
+	}
+	sort.Ints(index)
+	//驱动默认顺序执行
+	if ordered == nil || *ordered {
+		return models[index[0]:]
+	}
+	r := make([]mongo.WriteModel, 0, len(index))
+	for _, i := range index {
+		r = append(r, models[i])
+	}
+	return r
+}
+
+// SetBatchSize 每批提交的数量,超出时 Save 分批提交并合并结果,遇到错误时停止
+// 每批内部按照 Ordered 设置执行,批次之间总是顺序执行
+func (this *BulkWrite) SetBatchSize(n int) *BulkWrite {
+	this.size = n
+	return this
+}
+
+// merge 合并分批提交的结果,offset 为本批第一个操作的下标
+func (this *BulkWrite) merge(r *mongo.BulkWriteResult, offset int) {
+	this.result.InsertedCount += r.InsertedCount
+	this.result.MatchedCount += r.MatchedCount
+	this.result.ModifiedCount += r.ModifiedCount
+	this.result.DeletedCount += r.DeletedCount
+	this.result.UpsertedCount += r.UpsertedCount
+	for k, v := range r.UpsertedIDs {
+		this.result.UpsertedIDs[k+int64(offset)] = v
+	}
+}
+
 // Update 更新
 // data   map[string]any  update.Update  bson.M
 func (this *BulkWrite) Update(data any, where ...interface{}) {
 	stmt := this.tx.statement
 	query := clause.New()
+	query.Alias(this.tx.FieldAlias)
 	query.Where(where[0], where[1:]...)
 	value, upsert, err := update.Build(data, stmt.schema, &stmt.selector)
 	if err != nil {
@@ -82,6 +161,7 @@ func (this *BulkWrite) Insert(documents ...interface{}) {
 
 func (this *BulkWrite) Delete(where ...interface{}) {
 	query := clause.New()
+	query.Alias(this.tx.FieldAlias)
 	query.Where(where[0], where[1:]...)
 	filter := query.Build(this.tx.statement.schema)
 	multiple := clause.Multiple(filter)
@@ -97,10 +177,69 @@ func (this *BulkWrite) Delete(where ...interface{}) {
 	}
 }
 
+// Result 最后一次 Save 的结果,分批提交时为合并后的结果
 func (this *BulkWrite) Result() *mongo.BulkWriteResult {
 	return this.result
 }
 
+// InsertedCount 插入的文档数,未提交时为0
+func (this *BulkWrite) InsertedCount() int64 {
+	if this.result == nil {
+		return 0
+	}
+	return this.result.InsertedCount
+}
+
+// MatchedCount 更新时匹配的文档数
+func (this *BulkWrite) MatchedCount() int64 {
+	if this.result == nil {
+		return 0
+	}
+	return this.result.MatchedCount
+}
+
+// ModifiedCount 更新时修改的文档数
+func (this *BulkWrite) ModifiedCount() int64 {
+	if this.result == nil {
+		return 0
+	}
+	return this.result.ModifiedCount
+}
+
+// UpsertedCount upsert 插入的文档数
+func (this *BulkWrite) UpsertedCount() int64 {
+	if this.result == nil {
+		return 0
+	}
+	return this.result.UpsertedCount
+}
+
+// DeletedCount 删除的文档数
+func (this *BulkWrite) DeletedCount() int64 {
+	if this.result == nil {
+		return 0
+	}
+	return this.result.DeletedCount
+}
+
 func (this *BulkWrite) Options(opts ...*options.BulkWriteOptions) {
 	this.opts = append(this.opts, opts...)
 }
+
+// Ordered 是否顺序执行,默认 false
+// 无序执行时单个操作失败不影响其他操作,顺序执行时遇到失败的操作立即停止,之后的操作不会执行
+func (this *BulkWrite) Ordered(ordered bool) *BulkWrite {
+	this.ordered = &ordered
+	return this
+}
+
+// options 提交时使用的选项,没有设置时默认无序执行
+func (this *BulkWrite) options() []*options.BulkWriteOptions {
+	opts := this.opts
+	if this.ordered != nil {
+		opts = append(opts[:len(opts):len(opts)], options.BulkWrite().SetOrdered(*this.ordered))
+	} else if len(opts) == 0 {
+		opts = append(opts, options.BulkWrite().SetOrdered(false))
+	}
+	return opts
+}
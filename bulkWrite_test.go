@@ -0,0 +1,130 @@
+package cosmo
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestBulkWriteContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	//未连接数据库,Context 已取消时不会调用驱动
+	bw := New().WithContext(ctx).BulkWrite(&testItem{})
+	bw.Insert(&testItem{Id: 1})
+	if err := bw.Save(); !errors.Is(err, context.Canceled) {
+		t.Fatalf("BulkWrite cancelled context error:%v", err)
+	}
+	bw = New().BulkWrite(&testItem{}).WithContext(ctx)
+	bw.Insert(&testItem{Id: 1})
+	if err := bw.Save(); !errors.Is(err, context.Canceled) {
+		t.Fatalf("BulkWrite WithContext error:%v", err)
+	}
+}
+
+func TestBulkWriteBatchSize(t *testing.T) {
+	db := newTestDB(t)
+	resetItems(t, db)
+	bw := db.BulkWrite(&testItem{}).SetBatchSize(100)
+	for i := 1; i <= 250; i++ {
+		bw.Insert(&testItem{Id: i})
+	}
+	if err := bw.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if r := bw.Result(); r.InsertedCount != 250 {
+		t.Fatalf("BulkWrite merged result error:%+v", r)
+	}
+	//第二批存在重复主键,第一批成功后停止
+	bw = db.BulkWrite(&testItem{}).SetBatchSize(2)
+	bw.Insert(&testItem{Id: 251}, &testItem{Id: 252}, &testItem{Id: 1}, &testItem{Id: 253}, &testItem{Id: 254})
+	err := bw.Save()
+	if err == nil || !strings.Contains(err.Error(), "batch 1") || !strings.Contains(err.Error(), "2 models saved") {
+		t.Fatalf("BulkWrite batch error:%v", err)
+	}
+	//无序执行时第二批只保留失败的操作,第三批未执行
+	if len(bw.models) != 2 {
+		t.Fatalf("BulkWrite models left:%v", len(bw.models))
+	}
+}
+
+func TestBulkWriteFailedModels(t *testing.T) {
+	models := []mongo.WriteModel{mongo.NewInsertOneModel(), mongo.NewInsertOneModel(), mongo.NewInsertOneModel(), mongo.NewInsertOneModel()}
+	e := mongo.BulkWriteException{WriteErrors: []mongo.BulkWriteError{{WriteError: mongo.WriteError{Index: 3}}, {WriteError: mongo.WriteError{Index: 1}}}}
+	ordered, unordered := true, false
+	if r := failedModels(models, e, &ordered); len(r) != 3 || r[0] != models[1] {
+		t.Fatalf("ordered failed models error:%v", r)
+	}
+	if r := failedModels(models, e, nil); len(r) != 3 {
+		t.Fatalf("default ordered failed models error:%v", r)
+	}
+	if r := failedModels(models, e, &unordered); len(r) != 2 || r[0] != models[1] || r[1] != models[3] {
+		t.Fatalf("unordered failed models error:%v", r)
+	}
+	//无法确定执行情况时保留整个批次
+	if r := failedModels(models, errors.New("network"), &unordered); len(r) != 4 {
+		t.Fatalf("unknown error failed models:%v", r)
+	}
+	e.WriteConcernError = &mongo.WriteConcernError{}
+	if r := failedModels(models, e, &unordered); len(r) != 4 {
+		t.Fatalf("write concern error failed models:%v", r)
+	}
+}
+
+func TestBulkWriteCounts(t *testing.T) {
+	bw := New().BulkWrite(&testItem{})
+	if bw.InsertedCount() != 0 || bw.DeletedCount() != 0 {
+		t.Fatalf("counts before Save should be 0")
+	}
+	db := newTestDB(t)
+	resetItems(t, db, testItems()...)
+	bw = db.BulkWrite(&testItem{})
+	bw.Insert(&testItem{Id: 4}, &testItem{Id: 5})
+	bw.Update(bson.M{"lv": 10}, 1)
+	bw.Update(bson.M{"lv": 2}, 2)
+	bw.Delete(3)
+	if err := bw.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if bw.InsertedCount() != 2 || bw.MatchedCount() != 2 || bw.ModifiedCount() != 1 || bw.DeletedCount() != 1 || bw.UpsertedCount() != 0 {
+		t.Fatalf("BulkWrite counts error:%+v", bw.Result())
+	}
+	bw = db.Upsert().BulkWrite(&testItem{})
+	bw.Update(bson.M{"lv": 6}, 6)
+	if err := bw.Save(); err != nil || bw.UpsertedCount() != 1 {
+		t.Fatalf("BulkWrite upsert count error:%v,%+v", err, bw.Result())
+	}
+}
+
+func TestBulkWriteOrdered(t *testing.T) {
+	ordered := func(bw *BulkWrite) bool {
+		return *options.MergeBulkWriteOptions(bw.options()...).Ordered
+	}
+	bw := New().BulkWrite(&testItem{})
+	if ordered(bw) {
+		t.Fatalf("BulkWrite should be unordered by default")
+	}
+	bw.Ordered(true).Options(options.BulkWrite().SetOrdered(false))
+	if !ordered(bw) {
+		t.Fatalf("Ordered should override Options")
+	}
+
+	db := newTestDB(t)
+	resetItems(t, db, &testItem{Id: 2})
+	bw = db.BulkWrite(&testItem{}).Ordered(true)
+	bw.Insert(&testItem{Id: 1}, &testItem{Id: 2}, &testItem{Id: 3})
+	if err := bw.Save(); err == nil || bw.InsertedCount() != 1 {
+		t.Fatalf("ordered BulkWrite error:%v,%v", err, bw.InsertedCount())
+	}
+	resetItems(t, db, &testItem{Id: 2})
+	bw = db.BulkWrite(&testItem{}).Ordered(false)
+	bw.Insert(&testItem{Id: 1}, &testItem{Id: 2}, &testItem{Id: 3})
+	if err := bw.Save(); err == nil || bw.InsertedCount() != 2 {
+		t.Fatalf("unordered BulkWrite error:%v,%v", err, bw.InsertedCount())
+	}
+}
@@ -1,9 +1,15 @@
 package cosmo
 
 import (
+	"context"
 	"github.com/hwcer/cosgo/logger"
+	"github.com/hwcer/cosgo/schema"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -26,10 +32,27 @@ type CacheHandle interface {
 	Reload(ts int64, cb CacheSetter) error
 }
 
-func NewCache(handle CacheHandle) *Cache {
+// CacheDefaultPageSize Cache.Page 默认的最大分页大小
+const CacheDefaultPageSize = 300
+
+// CacheIndex 二级索引,返回对象的索引键,返回空字符串时不加入索引
+type CacheIndex func(v CacheModel) string
+
+// CacheOptions 缓存淘汰策略,分页和二级索引设置
+type CacheOptions struct {
+	Indexes    map[string]CacheIndex //二级索引 name => CacheIndex,使用 GetBy 查询
+	PageSize   int                   //Page 每页最大数量,默认 CacheDefaultPageSize
+	MaxEntries int                   //最大数量,超出时淘汰最久未访问的对象,0 不限制
+	TTL        time.Duration         //GetUpdate 距今超过 TTL 的对象过期,0 不过期
+}
+
+func NewCache(handle CacheHandle, opts ...CacheOptions) *Cache {
 	i := &Cache{handle: handle}
+	if len(opts) > 0 {
+		i.options = opts[0]
+	}
 	i.time = time.Now().Unix()
-	i.dataset = NewCacheData()
+	i.dataset.Store(NewCacheData())
 	return i
 }
 
@@ -38,7 +61,25 @@ func NewCacheData() *CacheData {
 }
 
 type CacheData struct {
-	dict map[any]CacheModel
+	dict  map[any]CacheModel
+	index map[string]map[string][]any //二级索引 name => key => []id
+}
+
+// buildIndex 重建二级索引
+func (this *CacheData) buildIndex(indexes map[string]CacheIndex) {
+	if len(indexes) == 0 {
+		return
+	}
+	this.index = make(map[string]map[string][]any, len(indexes))
+	for name, f := range indexes {
+		m := make(map[string][]any)
+		for id, v := range this.dict {
+			if k := f(v); k != "" {
+				m[k] = append(m[k], id)
+			}
+		}
+		this.index[name] = m
+	}
 }
 
 func (this *CacheData) Copy() *CacheData {
@@ -63,22 +104,132 @@ func (this *CacheData) setter(id any, i CacheModel) {
 	this.dict[id] = i
 }
 
+// Cache 写操作在锁中复制数据集后整体替换(copy-on-write),读操作无锁
 type Cache struct {
+	token   bson.Raw //change stream resume token
 	time    int64
 	handle  CacheHandle
 	cursor  []CacheModel
 	locker  sync.Mutex
-	dataset *CacheData
+	dataset atomic.Pointer[CacheData]
+	options CacheOptions
+	clock   atomic.Int64 //访问计数,用于 LRU 淘汰
+	access  sync.Map     //id => *atomic.Int64 最后访问时的 clock
+}
+
+// touch 记录访问顺序
+func (this *Cache) touch(id any) {
+	if this.options.MaxEntries <= 0 {
+		return
+	}
+	n := this.clock.Add(1)
+	if v, ok := this.access.Load(id); ok {
+		v.(*atomic.Int64).Store(n)
+		return
+	}
+	v := &atomic.Int64{}
+	v.Store(n)
+	this.access.Store(id, v)
+}
+
+// expired 是否超过 TTL
+func (this *Cache) expired(v CacheModel) bool {
+	return this.options.TTL > 0 && v.GetUpdate() < time.Now().Add(-this.options.TTL).Unix()
+}
+
+// load 读取未过期的对象
+func (this *Cache) load(id any) (v CacheModel, ok bool) {
+	if v, ok = this.dataset.Load().dict[id]; ok && this.expired(v) {
+		return nil, false
+	}
+	if ok {
+		this.touch(id)
+	}
+	return
+}
+
+// evict 在复制出的数据集中删除过期和超出数量的对象,必须在锁中调用
+func (this *Cache) evict(dataset *CacheData) {
+	for k, v := range dataset.dict {
+		if this.expired(v) {
+			delete(dataset.dict, k)
+			this.access.Delete(k)
+		}
+	}
+	n := len(dataset.dict) - this.options.MaxEntries
+	if this.options.MaxEntries <= 0 || n <= 0 {
+		return
+	}
+	type entry struct {
+		id     any
+		access int64
+	}
+	entries := make([]entry, 0, len(dataset.dict))
+	for k := range dataset.dict {
+		e := entry{id: k}
+		if v, ok := this.access.Load(k); ok {
+			e.access = v.(*atomic.Int64).Load()
+		}
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].access < entries[j].access
+	})
+	for _, e := range entries[:n] {
+		delete(dataset.dict, e.id)
+		this.access.Delete(e.id)
+	}
+}
+
+// Evict 立即执行淘汰策略
+func (this *Cache) Evict() {
+	this.locker.Lock()
+	defer this.locker.Unlock()
+	dataset := this.dataset.Load().Copy()
+	this.evict(dataset)
+	this.store(dataset)
+}
+
+// store 重建索引后替换数据集,必须在锁中调用
+func (this *Cache) store(dataset *CacheData) {
+	dataset.buildIndex(this.options.Indexes)
+	this.cursor = nil
+	this.dataset.Store(dataset)
+}
+
+// GetBy 使用二级索引查询,索引不存在时返回nil,同一个键可能对应多个对象
+func (this *Cache) GetBy(index string, key string) (r []CacheModel) {
+	dataset := this.dataset.Load()
+	for _, id := range dataset.index[index][key] {
+		if v, ok := dataset.dict[id]; ok && !this.expired(v) {
+			this.touch(id)
+			r = append(r, v)
+		}
+	}
+	return
+}
+
+// CacheGet 获取指定类型的缓存对象,不存在或者类型不一致时返回false
+func CacheGet[T CacheModel](c *Cache, id any) (r T, ok bool) {
+	if v, exist := c.load(id); exist {
+		r, ok = v.(T)
+	}
+	return
 }
 
 func (this *Cache) Len() int {
-	return len(this.dataset.dict)
+	return len(this.dataset.Load().dict)
 }
-func (this *Cache) Get(id string) any {
-	return this.dataset.dict[id]
+
+// Get id 类型必须和 CacheSetter 写入时一致
+func (this *Cache) Get(id any) any {
+	if v, ok := this.load(id); ok {
+		return v
+	}
+	return nil
 }
-func (this *Cache) Has(id string) (ok bool) {
-	_, ok = this.dataset.dict[id]
+func (this *Cache) Has(id any) (ok bool) {
+	_, ok = this.load(id)
 	return
 }
 
@@ -88,20 +239,18 @@ func (this *Cache) Lock(f func() error) error {
 	return f()
 }
 func (this *Cache) Cursor(update int64, filter CacheFilter) []any {
-	var cursor []CacheModel
-	if len(this.cursor) == 0 {
-		this.locker.Lock()
-		defer this.locker.Unlock()
-		for _, v := range this.dataset.dict {
+	this.locker.Lock()
+	cursor := this.cursor
+	if len(cursor) == 0 {
+		for _, v := range this.dataset.Load().dict {
 			cursor = append(cursor, v)
 		}
 		sort.Slice(cursor, func(i, j int) bool {
 			return cursor[i].GetUpdate() < cursor[j].GetUpdate()
 		})
 		this.cursor = cursor
-	} else {
-		cursor = this.cursor
 	}
+	this.locker.Unlock()
 	var r []any
 	for _, v := range cursor {
 		if s := this.filter(v, update, filter); s != nil {
@@ -112,7 +261,7 @@ func (this *Cache) Cursor(update int64, filter CacheFilter) []any {
 }
 
 func (this *Cache) filter(v CacheModel, update int64, filter CacheFilter) any {
-	if v.GetUpdate() <= update {
+	if v.GetUpdate() <= update || this.expired(v) {
 		return nil
 	}
 	if filter == nil {
@@ -123,38 +272,39 @@ func (this *Cache) filter(v CacheModel, update int64, filter CacheFilter) any {
 
 func (this *Cache) Page(page *Paging, filter CacheFilter) (err error) {
 	cursor := this.Cursor(page.Update, filter)
-	page.Init(300)
+	size := this.options.PageSize
+	if size <= 0 {
+		size = CacheDefaultPageSize
+	}
+	page.Init(size)
 	page.Result(len(cursor))
-	if page.Page > page.Total {
+	offset := page.Offset()
+	if offset >= len(cursor) {
 		return
 	}
-	offset := (page.Page - 1) * page.Size
-	end := offset + page.Size
-	if end > page.Record {
-		end = page.Record
-	}
+	end := min(offset+page.Size, len(cursor))
 	page.Rows = cursor[offset:end]
 	return
 }
 
 func (this *Cache) Range(f func(any) bool) {
-	for _, v := range this.dataset.dict {
+	for _, v := range this.dataset.Load().dict {
+		if this.expired(v) {
+			continue
+		}
 		if !f(v) {
 			return
 		}
 	}
 }
-func (this *Cache) Delete(id string) {
+func (this *Cache) Delete(id any) {
 	this.locker.Lock()
 	defer this.locker.Unlock()
-	this.cursor = nil
-	this.dataset = this.dataset.Delete(id)
+	this.access.Delete(id)
+	this.store(this.dataset.Load().Delete(id))
 }
 
 func (this *Cache) Reload(ts int64, handle ...CacheHandle) error {
-	if ts > 0 && ts <= this.time {
-		return nil
-	}
 	var h CacheHandle
 	if len(handle) > 0 {
 		h = handle[0]
@@ -164,29 +314,141 @@ func (this *Cache) Reload(ts int64, handle ...CacheHandle) error {
 
 	this.locker.Lock()
 	defer this.locker.Unlock()
-	dataset := this.dataset.Copy()
-	err := h.Reload(ts, dataset.setter)
+	if ts > 0 && ts <= this.time {
+		return nil
+	}
+	dataset := this.dataset.Load().Copy()
+	err := h.Reload(ts, func(k any, v CacheModel) {
+		//新加入的对象视为刚刚访问过,已有对象保持原来的访问顺序
+		if _, ok := dataset.dict[k]; !ok {
+			this.touch(k)
+		}
+		dataset.setter(k, v)
+	})
 	if err != nil {
 		return err
 	}
 	if ts > 0 {
 		this.time = ts
 	}
-	this.cursor = nil
-	this.dataset = dataset
+	this.evict(dataset)
+	this.store(dataset)
 	return nil
 }
 
 // Listener 监听数据库变化
 // id 变更数据ID
-// update 变化时间
-func (this *Cache) Listener(t CacheEventType, id string, update int64) {
+// update 变化时间,没有变化时间的新增和修改事件直接忽略,避免每个事件都重新加载全部数据
+func (this *Cache) Listener(t CacheEventType, id any, update int64) {
 	switch t {
 	case CacheEventTypeDelete:
 		this.Delete(id)
 	case CacheEventTypeUpdate, CacheEventTypeCreate:
+		if update <= 0 {
+			return
+		}
 		if err := this.Reload(update); err != nil {
 			logger.Alert("Cache Listener Reload[%v] error[%v]", id, err)
 		}
 	}
 }
+
+// CacheEventSource 数据库变更事件源,*mongo.ChangeStream 实现了该接口
+type CacheEventSource interface {
+	Next(ctx context.Context) bool
+	Decode(val interface{}) error
+	ResumeToken() bson.Raw
+	Err() error
+	Close(ctx context.Context) error
+}
+
+// cacheChangeEvent change stream 事件中使用到的字段
+type cacheChangeEvent struct {
+	OperationType     string `bson:"operationType"`
+	DocumentKey       bson.M `bson:"documentKey"`
+	FullDocument      bson.M `bson:"fullDocument"`
+	UpdateDescription struct {
+		UpdatedFields bson.M `bson:"updatedFields"`
+	} `bson:"updateDescription"`
+}
+
+// update 文档中的 update 字段,不存在时返回0
+func (this *cacheChangeEvent) update() int64 {
+	if v, ok := this.FullDocument[DBNameUpdate]; ok {
+		return schema.ToInt(v)
+	}
+	if v, ok := this.UpdateDescription.UpdatedFields[DBNameUpdate]; ok {
+		return schema.ToInt(v)
+	}
+	return 0
+}
+
+// ResumeToken 最后处理的事件位置,可以保存后在重启时使用 SetResumeToken 恢复
+func (this *Cache) ResumeToken() bson.Raw {
+	this.locker.Lock()
+	defer this.locker.Unlock()
+	return this.token
+}
+
+// SetResumeToken 设置 Watch 开始的位置
+func (this *Cache) SetResumeToken(token bson.Raw) {
+	this.locker.Lock()
+	defer this.locker.Unlock()
+	this.token = token
+}
+
+// Watch 使用 change stream 监听 db.Model 对应集合的变化并调用 Listener,需要副本集或分片集群
+// 断开后从最后处理的位置重新监听,直到ctx取消
+// CacheSetter 中的 id 必须使用文档的 _id,时间使用文档中的 update 字段
+func (this *Cache) Watch(ctx context.Context, db *DB) error {
+	if db.statement.model == nil {
+		return ErrModelValueRequired
+	}
+	tx, coll := db.Collection(db.statement.model)
+	if tx.Error != nil {
+		return tx.Error
+	}
+	for {
+		opts := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+		if token := this.ResumeToken(); token != nil {
+			opts.SetResumeAfter(token)
+		}
+		stream, err := coll.Watch(ctx, mongo.Pipeline{}, opts)
+		if err == nil {
+			err = this.WatchSource(ctx, stream)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		logger.Alert("Cache Watch error[%v]", err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// WatchSource 读取事件源直到结束或者ctx取消,结束时关闭事件源
+func (this *Cache) WatchSource(ctx context.Context, source CacheEventSource) error {
+	defer func() {
+		_ = source.Close(context.Background())
+	}()
+	for source.Next(ctx) {
+		event := &cacheChangeEvent{}
+		if err := source.Decode(event); err != nil {
+			return err
+		}
+		id := event.DocumentKey["_id"]
+		switch event.OperationType {
+		case "insert":
+			this.Listener(CacheEventTypeCreate, id, event.update())
+		case "update", "replace":
+			this.Listener(CacheEventTypeUpdate, id, event.update())
+		case "delete":
+			this.Listener(CacheEventTypeDelete, id, 0)
+		}
+		this.SetResumeToken(source.ResumeToken())
+	}
+	return source.Err()
+}
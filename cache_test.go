@@ -0,0 +1,257 @@
+package cosmo
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type testCacheItem struct {
+	Id     string
+	Update int64
+}
+
+func (this *testCacheItem) GetUpdate() int64 {
+	return this.Update
+}
+
+type testCacheHandle struct {
+	items []*testCacheItem
+}
+
+func (this *testCacheHandle) Reload(ts int64, cb CacheSetter) error {
+	for _, v := range this.items {
+		if v.Update >= ts || ts == 0 {
+			cb(v.Id, v)
+		}
+	}
+	return nil
+}
+
+func newTestCache(n int) (*Cache, *testCacheHandle) {
+	h := &testCacheHandle{}
+	for i := 1; i <= n; i++ {
+		h.items = append(h.items, &testCacheItem{Id: strconv.Itoa(i), Update: int64(i)})
+	}
+	c := NewCache(h)
+	if err := c.Reload(0); err != nil {
+		panic(err)
+	}
+	return c, h
+}
+
+func TestCacheGet(t *testing.T) {
+	c, _ := newTestCache(3)
+	if v, ok := CacheGet[*testCacheItem](c, "2"); !ok || v.Id != "2" {
+		t.Fatalf("CacheGet error:%v,%v", v, ok)
+	}
+	if _, ok := CacheGet[*testCacheItem](c, "9"); ok {
+		t.Fatalf("CacheGet not exist error")
+	}
+	if c.Get("9") != nil || !c.Has("1") || c.Len() != 3 {
+		t.Fatalf("Cache Get/Has error")
+	}
+}
+
+// TestCacheRace 使用 go test -race 运行
+func TestCacheRace(t *testing.T) {
+	c, _ := newTestCache(100)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				_, _ = CacheGet[*testCacheItem](c, strconv.Itoa(j%100))
+				c.Has("1")
+				c.Cursor(0, nil)
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for j := 0; j < 100; j++ {
+			if j%2 == 0 {
+				c.Delete(strconv.Itoa(j))
+			} else if err := c.Reload(0); err != nil {
+				t.Error(err)
+			}
+		}
+	}()
+	wg.Wait()
+}
+
+// testEventSource 模拟 change stream
+type testEventSource struct {
+	events []bson.M
+	index  int
+	closed bool
+}
+
+func (this *testEventSource) Next(ctx context.Context) bool {
+	if this.index >= len(this.events) || ctx.Err() != nil {
+		return false
+	}
+	this.index++
+	return true
+}
+
+func (this *testEventSource) Decode(val interface{}) error {
+	b, err := bson.Marshal(this.events[this.index-1])
+	if err != nil {
+		return err
+	}
+	return bson.Unmarshal(b, val)
+}
+
+func (this *testEventSource) ResumeToken() bson.Raw {
+	b, _ := bson.Marshal(bson.M{"_data": strconv.Itoa(this.index)})
+	return b
+}
+
+func (this *testEventSource) Err() error {
+	return nil
+}
+
+func (this *testEventSource) Close(ctx context.Context) error {
+	this.closed = true
+	return nil
+}
+
+func TestCacheWatchSource(t *testing.T) {
+	c, h := newTestCache(3)
+	h.items = append(h.items, &testCacheItem{Id: "4", Update: time.Now().Unix() + 100})
+	source := &testEventSource{events: []bson.M{
+		{"operationType": "insert", "documentKey": bson.M{"_id": "4"}, "fullDocument": bson.M{"_id": "4", "update": h.items[3].Update}},
+		{"operationType": "delete", "documentKey": bson.M{"_id": "1"}},
+	}}
+	if err := c.WatchSource(context.Background(), source); err != nil {
+		t.Fatal(err)
+	}
+	if !c.Has("4") || c.Has("1") || c.Len() != 3 {
+		t.Fatalf("WatchSource result error:%v", c.Len())
+	}
+	if !source.closed {
+		t.Fatalf("event source not closed")
+	}
+	if token := c.ResumeToken(); token.Lookup("_data").StringValue() != "2" {
+		t.Fatalf("resume token error:%v", token)
+	}
+}
+
+func TestCacheListenerWithoutUpdate(t *testing.T) {
+	c, h := newTestCache(3)
+	h.items = append(h.items, &testCacheItem{Id: "4"})
+	c.Listener(CacheEventTypeCreate, "4", 0)
+	c.Listener(CacheEventTypeUpdate, "4", 0)
+	if c.Has("4") || c.Len() != 3 {
+		t.Fatalf("Listener without update should be ignored:%v", c.Len())
+	}
+}
+
+func TestCacheMaxEntries(t *testing.T) {
+	h := &testCacheHandle{}
+	for i := 1; i <= 3; i++ {
+		h.items = append(h.items, &testCacheItem{Id: strconv.Itoa(i), Update: int64(i)})
+	}
+	c := NewCache(h, CacheOptions{MaxEntries: 3})
+	if err := c.Reload(0); err != nil {
+		t.Fatal(err)
+	}
+	c.Cursor(0, nil)
+	//访问1,2 后加入4,最久未访问的3被淘汰
+	c.Get("1")
+	c.Get("2")
+	h.items = append(h.items, &testCacheItem{Id: "4", Update: 4})
+	if err := c.Reload(0); err != nil {
+		t.Fatal(err)
+	}
+	if c.Len() != 3 || c.Has("3") || !c.Has("1") || !c.Has("4") {
+		t.Fatalf("MaxEntries eviction error:%v", c.Len())
+	}
+	if n := len(c.Cursor(0, nil)); n != 3 {
+		t.Fatalf("cursor not invalidated on eviction:%v", n)
+	}
+}
+
+func TestCacheTTL(t *testing.T) {
+	now := time.Now().Unix()
+	h := &testCacheHandle{items: []*testCacheItem{{Id: "old", Update: now - 3600}, {Id: "new", Update: now}}}
+	c := NewCache(h, CacheOptions{TTL: time.Minute})
+	if err := c.Reload(0); err != nil {
+		t.Fatal(err)
+	}
+	if c.Has("old") || !c.Has("new") || c.Len() != 1 {
+		t.Fatalf("TTL eviction error:%v", c.Len())
+	}
+	if _, ok := CacheGet[*testCacheItem](c, "old"); ok {
+		t.Fatalf("expired item returned")
+	}
+}
+
+func TestCachePage(t *testing.T) {
+	c, _ := newTestCache(10)
+	//过滤掉偶数后只剩5条
+	filter := func(v CacheModel) any {
+		if v.GetUpdate()%2 == 0 {
+			return nil
+		}
+		return v
+	}
+	page := &Paging{Page: 3, Size: 2}
+	if err := c.Page(page, filter); err != nil {
+		t.Fatal(err)
+	}
+	if rows := page.Rows.([]any); len(rows) != 1 || rows[0].(*testCacheItem).Id != "9" || page.Record != 5 || page.Total != 3 {
+		t.Fatalf("Cache Page error:%+v", page)
+	}
+	//超出范围时返回最后一页
+	page = &Paging{Page: 4, Size: 2}
+	if err := c.Page(page, filter); err != nil || page.Page != 3 || len(page.Rows.([]any)) != 1 {
+		t.Fatalf("Cache Page out of range error:%+v", page)
+	}
+	c = NewCache(&testCacheHandle{}, CacheOptions{PageSize: 5})
+	page = &Paging{Size: 100}
+	if err := c.Page(page, nil); err != nil || page.Size != 5 {
+		t.Fatalf("Cache PageSize error:%+v", page)
+	}
+}
+
+func TestCacheGetBy(t *testing.T) {
+	h := &testCacheHandle{}
+	for i := 1; i <= 4; i++ {
+		h.items = append(h.items, &testCacheItem{Id: strconv.Itoa(i), Update: int64(i)})
+	}
+	c := NewCache(h, CacheOptions{Indexes: map[string]CacheIndex{
+		"name": func(v CacheModel) string {
+			return "n" + v.(*testCacheItem).Id
+		},
+		"parity": func(v CacheModel) string {
+			return strconv.Itoa(int(v.GetUpdate() % 2))
+		},
+	}})
+	if err := c.Reload(0); err != nil {
+		t.Fatal(err)
+	}
+	if r := c.GetBy("name", "n3"); len(r) != 1 || r[0].(*testCacheItem).Id != "3" {
+		t.Fatalf("unique index error:%v", r)
+	}
+	if r := c.GetBy("parity", "0"); len(r) != 2 {
+		t.Fatalf("non-unique index error:%v", r)
+	}
+	c.Delete("2")
+	if r := c.GetBy("parity", "0"); len(r) != 1 || r[0].(*testCacheItem).Id != "4" {
+		t.Fatalf("index not maintained on Delete:%v", r)
+	}
+	if r := c.GetBy("name", "n2"); len(r) != 0 {
+		t.Fatalf("deleted item in index:%v", r)
+	}
+	if r := c.GetBy("none", "1"); r != nil {
+		t.Fatalf("unknown index error:%v", r)
+	}
+}
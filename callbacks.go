@@ -1,43 +1,81 @@
 package cosmo
 
-func initializeCallbacks() *callbacks {
-	cb := &callbacks{processors: make(map[string]*processor)}
-	cb.processors["query"] = &processor{handle: cmdQuery}
-	cb.processors["create"] = &processor{handle: cmdCreate}
-	cb.processors["update"] = &processor{handle: cmdUpdate}
-	cb.processors["delete"] = &processor{handle: cmdDelete}
+import (
+	"fmt"
+	"time"
+)
+
+// 可以使用 Callbacks.Register,Callbacks.Replace 修改的操作
+const (
+	CallbackQuery  = "query"
+	CallbackCreate = "create"
+	CallbackUpdate = "update"
+	CallbackDelete = "delete"
+)
+
+func initializeCallbacks() *Callbacks {
+	cb := &Callbacks{processors: make(map[string]*processor)}
+	cb.processors[CallbackQuery] = &processor{name: CallbackQuery, handle: cmdQuery}
+	cb.processors[CallbackCreate] = &processor{name: CallbackCreate, handle: cmdCreate, before: hookBeforeCreate, after: hookAfterCreate}
+	cb.processors[CallbackUpdate] = &processor{name: CallbackUpdate, handle: cmdUpdate, before: hookBeforeUpdate, after: hookAfterUpdate}
+	cb.processors[CallbackDelete] = &processor{name: CallbackDelete, handle: cmdDelete, before: hookBeforeDelete, after: hookAfterDelete}
 	return cb
 }
 
-// callbacks gorm callbacks manager
-type callbacks struct {
+// Callbacks 操作处理器,同一个 Config 创建的所有 DB 共用,需要在启动时注册,执行期间修改不是并发安全的
+type Callbacks struct {
 	processors map[string]*processor
 }
 
 type processor struct {
+	name   string
 	handle executeHandle
+	before hookHandle     //执行前调用的模型钩子
+	after  hookHandle     //执行成功后调用的模型钩子
+	around []AroundHandle //插件注册的处理器,先注册的在外层
+}
+
+// Register 为操作注册 AroundHandle,name 为 CallbackQuery,CallbackCreate,CallbackUpdate,CallbackDelete
+// 使用 Call 的自定义操作(Count,Aggregate 等)不会调用
+func (cs *Callbacks) Register(name string, handle AroundHandle) error {
+	p, ok := cs.processors[name]
+	if !ok {
+		return fmt.Errorf("callbacks processor not found:%v", name)
+	}
+	p.around = append(p.around, handle)
+	return nil
+}
+
+// Replace 替换操作的执行函数,模型钩子和已经注册的 AroundHandle 保持不变
+func (cs *Callbacks) Replace(name string, handle func(tx *DB) error) error {
+	p, ok := cs.processors[name]
+	if !ok {
+		return fmt.Errorf("callbacks processor not found:%v", name)
+	}
+	p.handle = handle
+	return nil
 }
 
 // Call 自定义调用
-func (cs *callbacks) Call(db *DB, handle executeHandle) *DB {
+func (cs *Callbacks) Call(db *DB, handle executeHandle) *DB {
 	p := &processor{handle: handle}
 	return p.Execute(db)
 }
 
-func (cs *callbacks) Create() *processor {
-	return cs.processors["create"]
+func (cs *Callbacks) Create() *processor {
+	return cs.processors[CallbackCreate]
 }
 
-func (cs *callbacks) Query() *processor {
-	return cs.processors["query"]
+func (cs *Callbacks) Query() *processor {
+	return cs.processors[CallbackQuery]
 }
 
-func (cs *callbacks) Update() *processor {
-	return cs.processors["update"]
+func (cs *Callbacks) Update() *processor {
+	return cs.processors[CallbackUpdate]
 }
 
-func (cs *callbacks) Delete() *processor {
-	return cs.processors["delete"]
+func (cs *Callbacks) Delete() *processor {
+	return cs.processors[CallbackDelete]
 }
 
 // Execute 执行操作
@@ -53,28 +91,56 @@ func (p *processor) Execute(db *DB) (tx *DB) {
 	if stmt.table == "" {
 		tx.Errorf("table not set, please set it like: db.model(&user) or db.table(\"users\") %+v")
 	}
-	//value || model 类型为Struct并且主键不为空时，设置为查询条件
-	//var reflectModel reflect.Value
-	//if stmt.model != nil {
-	//	reflectModel = reflect.Indirect(reflect.ValueOf(stmt.model))
-	//} else if stmt.reflectValue.Kind() == reflect.Struct {
-	//	reflectModel = stmt.reflectValue
-	//}
-	//if reflectModel.IsValid() && !reflectModel.IsZero() {
-	//	field := stmt.schema.LookUpField(clause.MongoPrimaryName)
-	//	if field != nil {
-	//		v := reflectModel.FieldByIndex(field.StructField.Index)
-	//		if v.IsValid() && !v.IsZero() {
-	//			stmt.Clause.Primary(v.Interface())
-	//		}
-	//	}
-	//}
+	//更新和删除没有查询条件时使用 model 或 value 中不为空的主键
+	if (p.name == CallbackUpdate || p.name == CallbackDelete) && stmt.Clause.Len() == 0 {
+		if v := stmt.primaryValue(); v != nil {
+			stmt.Clause.Primary(v)
+		}
+	}
 
 	if p.handle == nil || tx.Error != nil {
 		return
 	}
+	//调用方的 Context 已经取消或超时
+	if stmt.Context != nil {
+		if err := stmt.Context.Err(); err != nil {
+			tx.Errorf(err)
+			return
+		}
+	}
+	if tx.dryRun {
+		if err := p.dryRun(tx); err != nil {
+			tx.Errorf(err)
+		}
+		return
+	}
+	//只读取一次,执行过程中并发 Close 不影响本次操作
+	if stmt.client = tx.GetClient(); stmt.client == nil {
+		tx.Errorf(ErrClientClosed)
+		return
+	}
 	//defer tx.reset()
-	if err := p.handle(tx); err != nil {
+	next := func() error {
+		if err := callHooks(tx, p.before); err != nil {
+			return err
+		}
+		if err := p.handle(tx); err != nil {
+			return err
+		}
+		return callHooks(tx, p.after)
+	}
+	for i := len(p.around) - 1; i >= 0; i-- {
+		handle, inner := p.around[i], next
+		next = func() error {
+			return handle(tx, inner)
+		}
+	}
+	begin := time.Now()
+	err := next()
+	if tx.logger != nil {
+		logExecute(tx, p.name, time.Since(begin), err)
+	}
+	if err != nil {
 		tx.Errorf(err)
 		return
 	}
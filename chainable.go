@@ -4,7 +4,12 @@ import (
 	"fmt"
 	"github.com/hwcer/cosgo/schema"
 	"github.com/hwcer/cosmo/clause"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
 	"reflect"
+	"time"
 )
 
 // Model specify the model you would like to run db operations
@@ -23,7 +28,7 @@ func (db *DB) Model(value any, modify ...bool) (tx *DB) {
 }
 
 // table specify the table you would like to run db operations
-// 使用TABLE 时select,order,Omit 中必须使用数据库字段名称
+// 没有使用 Model 时 select,order,Omit 中必须使用数据库字段名称,使用 Model 时对象字段名和数据库字段名都可以使用
 
 func (db *DB) Table(name string) (tx *DB) {
 	tx = db.getInstance()
@@ -38,6 +43,69 @@ func (db *DB) Upsert() (tx *DB) {
 	return
 }
 
+// AllowDiskUse 聚合时允许使用磁盘临时文件,突破100M内存限制
+func (db *DB) AllowDiskUse() (tx *DB) {
+	tx = db.getInstance()
+	tx.statement.allowDiskUse = true
+	return
+}
+
+// ReturnDocument FindOneAndReplace 返回修改前(options.Before)或修改后(options.After)的文档,默认 options.After
+func (db *DB) ReturnDocument(rd options.ReturnDocument) (tx *DB) {
+	tx = db.getInstance()
+	tx.statement.returnDocument = rd
+	return
+}
+
+// TextSearch 全文检索,集合需要建立文本索引
+//
+//	db.TextSearch("coffee", clause.TextLanguage("en")).TextScore("score").Find(&rows)
+func (db *DB) TextSearch(term string, opts ...clause.TextOption) (tx *DB) {
+	tx = db.getInstance()
+	tx.statement.Clause.TextSearch(term, opts...)
+	return
+}
+
+// TextScore 将全文检索相关度写入 field 字段并按相关度从高到低排序
+// field 为数据库字段名,通常在模型中定义 Score float64 `bson:"score,omitempty"`
+func (db *DB) TextScore(field string) (tx *DB) {
+	tx = db.getInstance()
+	tx.statement.textScore = field
+	return
+}
+
+// Hint 强制使用索引,index 为索引名称或者索引键 bson.D{{"name",1}}
+// 索引不存在时数据库返回错误
+func (db *DB) Hint(index any) (tx *DB) {
+	tx = db.getInstance()
+	tx.statement.hint = index
+	return
+}
+
+// Collation 设置字符串比较规则,作用于查询,统计和更新
+//
+//	db.Collation(&options.Collation{Locale: "en", Strength: 2}) //忽略大小写
+func (db *DB) Collation(c *options.Collation) (tx *DB) {
+	tx = db.getInstance()
+	tx.statement.collation = c
+	return
+}
+
+// MaxTime 服务器端执行时间上限(maxTimeMS),作用于查询,统计和更新
+// 与 WithContext 设置的 deadline 相互独立,同时生效
+func (db *DB) MaxTime(d time.Duration) (tx *DB) {
+	tx = db.getInstance()
+	tx.statement.maxTime = d
+	return
+}
+
+// Unscoped 忽略软删除,查询和统计包含已删除的文档,Delete 时物理删除
+func (db *DB) Unscoped() (tx *DB) {
+	tx = db.getInstance()
+	tx.statement.unscoped = true
+	return
+}
+
 // Multiple 强制批量更新
 func (db *DB) Multiple() (tx *DB) {
 	tx = db.getInstance()
@@ -45,6 +113,15 @@ func (db *DB) Multiple() (tx *DB) {
 	return
 }
 
+// Unset 更新时删除字段,与 Struct,map 中的 $set 合并为一次更新,同时出现在 $set 中的字段被删除
+//
+//	db.Model(&User{}).Unset("Email").Update(bson.M{"name": "hwc"}, 1)
+func (db *DB) Unset(keys ...string) (tx *DB) {
+	tx = db.getInstance()
+	tx.statement.unset = append(tx.statement.unset, keys...)
+	return
+}
+
 // Omit specify fields that you want to ignore when creating, updating and querying
 func (db *DB) Omit(columns ...string) (tx *DB) {
 	tx = db.getInstance()
@@ -63,6 +140,25 @@ func (db *DB) Select(columns ...string) (tx *DB) {
 	return
 }
 
+// ClearSelect 清除 Select,Omit 设置的字段
+// 每次从非克隆DB发起的链式调用都会使用新的Statement,只有在复用同一个克隆体时才需要手动清除
+func (db *DB) ClearSelect() (tx *DB) {
+	tx = db.getInstance()
+	tx.statement.selector.Release()
+	return
+}
+
+// ElemMatchProject 数组字段只返回第一个满足cond的元素
+// cond 中使用数组元素的数据库字段名
+func (db *DB) ElemMatchProject(field string, cond clause.Filter) (tx *DB) {
+	tx = db.getInstance()
+	if tx.statement.elemMatch == nil {
+		tx.statement.elemMatch = map[string]clause.Filter{}
+	}
+	tx.statement.elemMatch[field] = cond
+	return
+}
+
 // FindAndUpdate 查询并更新,需要配合Select使用
 //func (db *DB) FindAndUpdate() (tx *DB) {
 //	tx = db.getInstance()
@@ -78,6 +174,19 @@ func (db *DB) Where(query interface{}, args ...interface{}) (tx *DB) {
 	return
 }
 
+// TimeRange 时间范围查询 from <= field < to
+// from,to 为零值时表示不限制开始或结束时间
+func (db *DB) TimeRange(field string, from, to time.Time) (tx *DB) {
+	tx = db.getInstance()
+	if !from.IsZero() {
+		tx.statement.Clause.Gte(field, from)
+	}
+	if !to.IsZero() {
+		tx.statement.Clause.Lt(field, to)
+	}
+	return
+}
+
 // Page 分页设置 page-当前页，size-每页大小
 //func (db *DB) Page(page, size int) (tx *DB) {
 //	tx = db.getInstance()
@@ -88,7 +197,30 @@ func (db *DB) Where(query interface{}, args ...interface{}) (tx *DB) {
 // Order specify order when retrieve records from dbname
 func (db *DB) Order(key string, value int) (tx *DB) {
 	tx = db.getInstance()
-	tx.statement.Paging.Order(key, value)
+	tx.statement.orders = append(tx.statement.orders, bson.E{Key: key, Value: sortValue(value)})
+	return
+}
+
+// WriteConcern 本次写入使用的 WriteConcern,例如 writeconcern.Majority(),writeconcern.Unacknowledged()
+// 在事务中无效,使用事务的设置
+func (db *DB) WriteConcern(wc *writeconcern.WriteConcern) (tx *DB) {
+	tx = db.getInstance()
+	tx.statement.writeConcern = wc
+	return
+}
+
+// ReadConcern 本次查询使用的 ReadConcern,例如 readconcern.Majority()
+// 在事务中无效,使用事务的设置
+func (db *DB) ReadConcern(rc *readconcern.ReadConcern) (tx *DB) {
+	tx = db.getInstance()
+	tx.statement.readConcern = rc
+	return
+}
+
+// BatchSize 查询时游标每批从数据库读取的文档数量,用于 Range,Find,Page 等读取大量文档时调整往返次数和内存占用
+func (db *DB) BatchSize(n int) (tx *DB) {
+	tx = db.getInstance()
+	tx.statement.cursorBatchSize = n
 	return
 }
 
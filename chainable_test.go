@@ -0,0 +1,275 @@
+package cosmo
+
+import (
+	"context"
+	"github.com/hwcer/cosmo/clause"
+	"github.com/hwcer/cosmo/update"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestClearSelect(t *testing.T) {
+	db := New()
+	tx := db.Model(&Role{}).Select("Name")
+	if tx.Error != nil {
+		t.Fatal(tx.Error)
+	}
+	if tx.statement.selector.Has("Lv") {
+		t.Fatalf("Select not applied")
+	}
+	//新的链式调用不会继承之前的 Select
+	if tx2 := db.Model(&Role{}).Omit("Name"); tx2.Error != nil {
+		t.Fatalf("selector leak between operations:%v", tx2.Error)
+	}
+	//同一个克隆体上 Select 之后 Omit 冲突,清除后恢复
+	if tx.Omit("Lv"); tx.Error != ErrOmitOnSelectsExist {
+		t.Fatalf("want ErrOmitOnSelectsExist,got:%v", tx.Error)
+	}
+	tx.Error = nil
+	if tx = tx.ClearSelect().Omit("Lv"); tx.Error != nil {
+		t.Fatalf("ClearSelect error:%v", tx.Error)
+	}
+	if tx.statement.selector.Has("Lv") || !tx.statement.selector.Has("Name") {
+		t.Fatalf("ClearSelect selector error")
+	}
+}
+
+type testCart struct {
+	Id    int             `bson:"_id"`
+	Items []*testCartItem `bson:"items"`
+}
+
+type testCartItem struct {
+	Product string `bson:"product"`
+	Num     int    `bson:"num"`
+}
+
+func TestElemMatchProject(t *testing.T) {
+	db := New()
+	tx := db.Model(&testCart{}).Select("Id").ElemMatchProject("Items", clause.Filter{"product": "p1"})
+	if tx = tx.statement.Parse(); tx.Error != nil {
+		t.Fatal(tx.Error)
+	}
+	want := bson.M{"_id": true, "items": bson.M{"$elemMatch": clause.Filter{"product": "p1"}}}
+	if p := tx.statement.Projection(); !reflect.DeepEqual(p, want) {
+		t.Fatalf("ElemMatchProject projection error:%v", p)
+	}
+}
+
+func TestTimeRange(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 1, 0)
+	db := New()
+	cases := []struct {
+		from, to time.Time
+		want     clause.Filter
+	}{
+		{from, to, clause.Filter{"created": bson.M{"$gte": from, "$lt": to}}},
+		{from, time.Time{}, clause.Filter{"created": bson.M{"$gte": from}}},
+		{time.Time{}, to, clause.Filter{"created": bson.M{"$lt": to}}},
+	}
+	for _, c := range cases {
+		tx := db.Table("logs").TimeRange("created", c.from, c.to)
+		if filter := tx.statement.Clause.Build(nil); !reflect.DeepEqual(filter, c.want) {
+			t.Fatalf("TimeRange error:%v", filter)
+		}
+	}
+}
+
+func TestHint(t *testing.T) {
+	tx := New().Table("logs").Hint("idx_name")
+	if opts := tx.statement.findOptions(); opts.Hint != "idx_name" {
+		t.Fatalf("Hint not set on FindOptions:%v", opts.Hint)
+	}
+	if opts := tx.statement.findOneOptions(); opts.Hint != "idx_name" {
+		t.Fatalf("Hint not set on FindOneOptions:%v", opts.Hint)
+	}
+	if opts := tx.statement.countOptions(); opts.Hint != "idx_name" {
+		t.Fatalf("Hint not set on CountOptions:%v", opts.Hint)
+	}
+}
+
+func TestCollation(t *testing.T) {
+	c := &options.Collation{Locale: "en", Strength: 2}
+	tx := New().Table("logs").Collation(c)
+	if tx.statement.findOptions().Collation != c || tx.statement.findOneOptions().Collation != c || tx.statement.countOptions().Collation != c {
+		t.Fatalf("Collation not set on options")
+	}
+	if New().Table("logs").statement.findOptions().Collation != nil {
+		t.Fatalf("Collation should be nil by default")
+	}
+}
+
+func TestMaxTime(t *testing.T) {
+	tx := New().Table("logs").MaxTime(time.Second)
+	if opts := tx.statement.findOptions(); opts.MaxTime == nil || *opts.MaxTime != time.Second {
+		t.Fatalf("MaxTime not set on FindOptions:%v", opts.MaxTime)
+	}
+	if opts := tx.statement.findOneOptions(); opts.MaxTime == nil || *opts.MaxTime != time.Second {
+		t.Fatalf("MaxTime not set on FindOneOptions:%v", opts.MaxTime)
+	}
+	if opts := tx.statement.countOptions(); opts.MaxTime == nil || *opts.MaxTime != time.Second {
+		t.Fatalf("MaxTime not set on CountOptions:%v", opts.MaxTime)
+	}
+	if New().Table("logs").statement.findOptions().MaxTime != nil {
+		t.Fatalf("MaxTime should be nil by default")
+	}
+	//更新使用派生 Context,与调用方的 deadline 同时生效
+	parent, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+	ctx, done := New().WithContext(parent).Table("logs").MaxTime(time.Second).statement.maxTimeContext()
+	defer done()
+	if deadline, ok := ctx.Deadline(); !ok || time.Until(deadline) > time.Second {
+		t.Fatalf("MaxTime context deadline error:%v", deadline)
+	}
+}
+
+type testSoftDelete struct {
+	Id      int    `bson:"_id"`
+	Name    string `bson:"name"`
+	Deleted int64  `bson:"deleted" cosmo:"softDelete"`
+}
+
+func TestUnscoped(t *testing.T) {
+	db := New()
+	scope := clause.Filter{"deleted": bson.M{"$in": bson.A{nil, int64(0)}}}
+	tx := db.Model(&testSoftDelete{})
+	if tx = tx.statement.Parse(); tx.Error != nil {
+		t.Fatal(tx.Error)
+	}
+	if filter := tx.statement.Filter(); !reflect.DeepEqual(filter, scope) {
+		t.Fatalf("soft delete scope error:%v", filter)
+	}
+	//已经使用标记字段过滤时不追加条件
+	tx = db.Model(&testSoftDelete{}).Where("deleted > ?", 0)
+	if tx = tx.statement.Parse(); tx.Error != nil {
+		t.Fatal(tx.Error)
+	}
+	if filter := tx.statement.Filter(); !reflect.DeepEqual(filter, clause.Filter{"deleted": bson.M{"$gt": 0}}) {
+		t.Fatalf("soft delete scope on marker error:%v", filter)
+	}
+	tx = db.Model(&testSoftDelete{}).Unscoped()
+	if tx = tx.statement.Parse(); tx.Error != nil {
+		t.Fatal(tx.Error)
+	}
+	if filter := tx.statement.Filter(); len(filter) != 0 {
+		t.Fatalf("Unscoped filter error:%v", filter)
+	}
+}
+
+func TestTextScore(t *testing.T) {
+	tx := New().Model(&testItem{}).TextSearch("coffee", clause.TextLanguage("en")).Select("Name").Order("Lv", -1).TextScore("score")
+	tx = tx.statement.Parse()
+	if tx.Error != nil {
+		t.Fatal(tx.Error)
+	}
+	opts := tx.statement.findOptions()
+	wantSort := bson.D{{Key: "score", Value: bson.M{"$meta": "textScore"}}, {Key: "lv", Value: -1}}
+	if !reflect.DeepEqual(opts.Sort, wantSort) {
+		t.Fatalf("text score sort = %v, want %v", opts.Sort, wantSort)
+	}
+	wantProjection := bson.M{"name": true, "score": bson.M{"$meta": "textScore"}}
+	if !reflect.DeepEqual(opts.Projection, wantProjection) {
+		t.Fatalf("text score projection = %v, want %v", opts.Projection, wantProjection)
+	}
+	filter := tx.statement.Clause.Build(tx.statement.schema)
+	if !reflect.DeepEqual(filter, clause.Filter{"$text": bson.M{"$search": "coffee", "$language": "en"}}) {
+		t.Fatalf("text search filter error:%v", filter)
+	}
+}
+
+func TestSelectProjection(t *testing.T) {
+	db := New()
+	model := db.Model(&testItem{}).Select("Name", "Lv")
+	if model = model.statement.Parse(); model.Error != nil {
+		t.Fatal(model.Error)
+	}
+	//Table 没有模型
+	table := db.Table("items").Select("name", "lv")
+	want := bson.M{"name": true, "lv": true}
+	if p := model.statement.Projection(); !reflect.DeepEqual(p, want) {
+		t.Fatalf("Model Select projection error:%v", p)
+	}
+	if p := table.statement.Projection(); !reflect.DeepEqual(p, want) {
+		t.Fatalf("Table Select projection error:%v", p)
+	}
+	//模型中混用数据库字段名
+	omit := db.Model(&testItem{}).Omit("status", "Lv")
+	if omit = omit.statement.Parse(); omit.Error != nil {
+		t.Fatal(omit.Error)
+	}
+	if p := omit.statement.findOptions().Projection; !reflect.DeepEqual(p, bson.M{"status": false, "lv": false}) {
+		t.Fatalf("Omit projection error:%v", p)
+	}
+}
+
+func TestConcern(t *testing.T) {
+	wc := writeconcern.Majority()
+	rc := readconcern.Majority()
+	tx := New().Table("logs").WriteConcern(wc).ReadConcern(rc)
+	if opts := tx.statement.collectionOptions(); opts.WriteConcern != wc || opts.ReadConcern != rc {
+		t.Fatalf("concern not set on CollectionOptions:%+v", opts)
+	}
+	if opts := New().Table("logs").statement.collectionOptions(); opts.WriteConcern != nil || opts.ReadConcern != nil {
+		t.Fatalf("concern should be nil by default")
+	}
+	db := newTestDB(t)
+	resetItems(t, db)
+	if tx = db.WriteConcern(wc).Create(&testItem{Id: 1, Name: "a"}); tx.Error != nil {
+		t.Fatal(tx.Error)
+	}
+	var n int64
+	if tx = db.Model(&testItem{}).ReadConcern(rc).Count(&n); tx.Error != nil || n != 1 {
+		t.Fatalf("ReadConcern count error:%v,%v", tx.Error, n)
+	}
+}
+
+func TestBatchSize(t *testing.T) {
+	if opts := New().Table("logs").BatchSize(100).statement.findOptions(); opts.BatchSize == nil || *opts.BatchSize != 100 {
+		t.Fatalf("BatchSize not set on FindOptions:%v", opts.BatchSize)
+	}
+	if opts := New().Table("logs").BatchSize(100).Limit(10).statement.findOptions(); opts.BatchSize == nil || *opts.BatchSize != 10 {
+		t.Fatalf("BatchSize should not exceed limit:%v", opts.BatchSize)
+	}
+	if opts := New().Table("logs").statement.findOptions(); opts.BatchSize != nil {
+		t.Fatalf("BatchSize should be nil by default")
+	}
+	db := newTestDB(t)
+	resetItems(t, db, testItems()...)
+	var ids []int
+	tx := db.Model(&testItem{}).Order("_id", 1).BatchSize(1).Range(func(c Cursor) bool {
+		item := &testItem{}
+		if err := c.Decode(item); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, item.Id)
+		return true
+	})
+	if tx.Error != nil || !reflect.DeepEqual(ids, []int{1, 2, 3}) {
+		t.Fatalf("Range with BatchSize error:%v,%v", tx.Error, ids)
+	}
+}
+
+func TestUnset(t *testing.T) {
+	db := New().Session(&Session{DryRun: true})
+	tx := db.Model(&testItem{}).Unset("Status", "extra").Update(map[string]any{"Name": "x"}, 1)
+	want := update.Update{update.UpdateTypeSet: {"name": "x"}, update.UpdateTypeUnset: {"status": 1, "extra": 1}}
+	if r := tx.DryRunResult(); tx.Error != nil || !reflect.DeepEqual(r.Update, want) {
+		t.Fatalf("Unset with map error:%v,%+v", tx.Error, r)
+	}
+	//Struct 中的非零值字段被删除
+	tx = db.Model(&testItem{}).Unset("Status").Update(&testItem{Name: "x", Status: "active"}, 1)
+	if r := tx.DryRunResult(); tx.Error != nil || !reflect.DeepEqual(r.Update, update.Update{update.UpdateTypeSet: {"name": "x"}, update.UpdateTypeUnset: {"status": 1}}) {
+		t.Fatalf("Unset with struct error:%v,%+v", tx.Error, r)
+	}
+	//只删除字段
+	tx = db.Model(&testItem{}).Unset("Status").Update(map[string]any{}, 1)
+	if r := tx.DryRunResult(); tx.Error != nil || !reflect.DeepEqual(r.Update, update.Update{update.UpdateTypeUnset: {"status": 1}}) {
+		t.Fatalf("Unset only error:%v,%+v", tx.Error, r)
+	}
+}
@@ -1,33 +1,74 @@
 package clause
 
-import "github.com/hwcer/cosgo/schema"
+import (
+	"github.com/hwcer/cosgo/schema"
+	"reflect"
+)
 
 // Build 生成mongo查询条件
 func (q *Query) Build(model *schema.Schema) Filter {
 	filter := make(Filter)
 	for _, node := range q.where {
-		build(model, filter, node)
+		q.build(model, filter, node)
 	}
 	for _, t := range complexCondition {
 		for _, node := range q.complex[t] {
 			v := make(Filter)
-			build(model, v, node)
+			q.build(model, v, node)
 			filter.Match(t, v)
 		}
 	}
 	return filter
 }
 
-func build(model *schema.Schema, filter Filter, node *Node) {
+func (q *Query) build(model *schema.Schema, filter Filter, node *Node) {
+	if node.t == queryOperationText {
+		filter[queryOperationText] = node.v
+		return
+	}
 	k := node.k
-	if model != nil {
-		if filed := model.LookUpField(node.k); filed != nil {
-			k = filed.DBName
+	if name, ok := q.alias[k]; ok {
+		k = name
+	}
+	if sub, ok := node.v.(*Query); ok && k == "" {
+		//OR,AND 等逻辑组合中的子查询
+		for sk, sv := range sub.Build(model) {
+			filter[sk] = sv
 		}
+		return
+	}
+	if sub, ok := node.v.(*Query); ok {
+		filter.Any(node.t, DBName(model, k), sub.Build(elemSchema(model, k)))
+		return
 	}
+	k = DBName(model, k)
 	if node.t == QueryOperationPrefix {
 		filter.Eq(k, node.v)
+	} else if bounds, ok := node.v.([2]interface{}); ok && node.t == queryOperationBetween {
+		filter.Gte(k, bounds[0])
+		filter.Lte(k, bounds[1])
 	} else {
 		filter.Any(node.t, k, node.v)
 	}
 }
+
+// elemSchema 数组字段中元素对象的schema,用于$elemMatch子查询字段转换
+func elemSchema(model *schema.Schema, k string) *schema.Schema {
+	if model == nil {
+		return nil
+	}
+	field := model.LookUpField(k)
+	if field == nil {
+		return nil
+	}
+	if field.Embedded != nil {
+		return field.Embedded
+	}
+	switch field.IndirectFieldType.Kind() {
+	case reflect.Slice, reflect.Array:
+		if sch, err := schema.Parse(reflect.New(field.IndirectFieldType).Interface()); err == nil {
+			return sch
+		}
+	}
+	return nil
+}
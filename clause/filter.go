@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"github.com/hwcer/cosmo/utils"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"strings"
 )
 
@@ -88,6 +89,12 @@ func (this Filter) Lte(k string, v interface{}) {
 	this.Any("$lte", k, v)
 }
 
+// Between 范围查询 lo <= k <= hi
+func (this Filter) Between(k string, lo, hi interface{}) {
+	this.Gte(k, lo)
+	this.Lte(k, hi)
+}
+
 //Ne 不等于（!=）
 func (this Filter) Ne(k string, v interface{}) {
 	this.Any("$ne", k, v)
@@ -103,6 +110,46 @@ func (this Filter) Nin(k string, v ...interface{}) {
 	this.Any("$nin", k, v)
 }
 
+//Exists 字段是否存在,v=true 存在,v=false 不存在
+func (this Filter) Exists(k string, v bool) {
+	this.Any("$exists", k, v)
+}
+
+//Regex 正则匹配,pattern 为正则表达式,用户输入请先使用 regexp.QuoteMeta 转义
+func (this Filter) Regex(k string, pattern string, options ...string) {
+	this.Any("$regex", k, primitive.Regex{Pattern: pattern, Options: strings.Join(options, "")})
+}
+
+// Mod 取模匹配,字段值除以 divisor 余数为 remainder
+func (this Filter) Mod(k string, divisor, remainder interface{}) {
+	this.Any("$mod", k, []interface{}{divisor, remainder})
+}
+
+// Size 数组长度等于n,$size 不支持范围查询
+func (this Filter) Size(k string, n int) {
+	this.Any("$size", k, n)
+}
+
+// BitsAllSet 指定的位全部为1,mask 为整数位掩码或者位序号数组 []int
+func (this Filter) BitsAllSet(k string, mask interface{}) {
+	this.Any("$bitsAllSet", k, mask)
+}
+
+// BitsAnySet 指定的位至少有一个为1
+func (this Filter) BitsAnySet(k string, mask interface{}) {
+	this.Any("$bitsAnySet", k, mask)
+}
+
+// BitsAllClear 指定的位全部为0
+func (this Filter) BitsAllClear(k string, mask interface{}) {
+	this.Any("$bitsAllClear", k, mask)
+}
+
+// BitsAnyClear 指定的位至少有一个为0
+func (this Filter) BitsAnyClear(k string, mask interface{}) {
+	this.Any("$bitsAnyClear", k, mask)
+}
+
 //OR The $or operator performs a logical OR operation on an array of two or more <expressions> and selects the documents that satisfy at least one of the <expressions>.
 func (this Filter) OR(v interface{}) {
 	this.Match("$or", v)
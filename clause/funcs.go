@@ -1,6 +1,12 @@
 package clause
 
-import "go.mongodb.org/mongo-driver/bson"
+import (
+	"github.com/hwcer/cosgo/schema"
+	"go.mongodb.org/mongo-driver/bson"
+	"strings"
+)
+
+const MongodbFieldSplit = "."
 
 //Multiple 使用主键判断是批量操作还是单个文档操作
 func Multiple(query Filter) bool {
@@ -14,3 +20,34 @@ func Multiple(query Filter) bool {
 	}
 	return false
 }
+
+//DBName 将对象字段名转换成数据库字段名
+//支持使用 . 分隔的嵌套字段,对象路径 Profile.Email 和数据库路径 profile.email 都会转换成 profile.email
+//无法解析的部分保持原样
+func DBName(model *schema.Schema, name string) string {
+	if model == nil {
+		return name
+	}
+	if field := model.LookUpField(name); field != nil {
+		return field.DBName
+	}
+	if !strings.Contains(name, MongodbFieldSplit) {
+		return name
+	}
+	keys := strings.Split(name, MongodbFieldSplit)
+	path := make([]string, 0, len(keys))
+	sch := model
+	for i, k := range keys {
+		var field *schema.Field
+		if sch != nil {
+			field = sch.LookUpField(k)
+		}
+		if field == nil {
+			path = append(path, keys[i:]...)
+			break
+		}
+		path = append(path, field.DBName)
+		sch = field.Embedded
+	}
+	return strings.Join(path, MongodbFieldSplit)
+}
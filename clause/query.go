@@ -2,13 +2,19 @@ package clause
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"strings"
 )
 
 const (
 	MongoPrimaryName     = "_id"
 	QueryOperationPrefix = "$"
+
+	queryOperationBetween = "$between" //范围查询,Build 时转换成 $gte,$lte
+	queryOperationText    = "$text"    //全文检索,不对应具体字段
 )
 
 const (
@@ -18,6 +24,8 @@ const (
 	QueryOperationNOR = "nor"
 )
 
+var ErrInvalidWhere = errors.New("invalid where condition")
+
 var complexCondition = []string{QueryOperationOR, QueryOperationAND, QueryOperationNOT, QueryOperationNOR}
 
 func New() *Query {
@@ -32,10 +40,63 @@ type Node struct {
 	v interface{}
 }
 
+// NewNode 创建查询条件节点,用于 OR,AND 等逻辑组合
+// op 为操作符,例如 gt,$gt,空字符串表示等于
+func NewNode(op, key string, value any) *Node {
+	if !strings.HasPrefix(op, QueryOperationPrefix) {
+		op = QueryOperationPrefix + op
+	}
+	return &Node{t: op, k: key, v: value}
+}
+
 type Query struct {
 	where []*Node
+	alias map[string]string //字段别名 alias => struct field
 	//primary []interface{} //主键
 	complex map[string][]*Node
+	err     error //Where 解析失败的错误,通过 Err() 获取
+}
+
+// Err Where 条件解析错误,存在错误时不能执行查询,避免条件丢失后操作整个集合
+func (q *Query) Err() error {
+	return q.err
+}
+
+// Alias 设置字段别名,Build时先将别名转换成对象字段名再转换成数据库字段名
+func (q *Query) Alias(alias map[string]string) {
+	q.alias = alias
+}
+
+// Clone 复制查询条件,在公共条件的基础上派生多个查询时使用,修改副本不影响原查询
+func (q *Query) Clone() *Query {
+	r := &Query{err: q.err}
+	r.where = cloneNodes(q.where)
+	r.complex = make(map[string][]*Node, len(q.complex))
+	for k, nodes := range q.complex {
+		r.complex[k] = cloneNodes(nodes)
+	}
+	if q.alias != nil {
+		r.alias = make(map[string]string, len(q.alias))
+		for k, v := range q.alias {
+			r.alias[k] = v
+		}
+	}
+	return r
+}
+
+func cloneNodes(nodes []*Node) []*Node {
+	if nodes == nil {
+		return nil
+	}
+	r := make([]*Node, len(nodes))
+	for i, node := range nodes {
+		n := *node
+		if sub, ok := n.v.(*Query); ok {
+			n.v = sub.Clone()
+		}
+		r[i] = &n
+	}
+	return r
 }
 
 func (q *Query) Len() (r int) {
@@ -47,83 +108,219 @@ func (q *Query) Len() (r int) {
 }
 
 //Primary 使用主键匹配 一个值或者数组
-func (q *Query) Primary(v interface{}) {
-	q.Eq(MongoPrimaryName, v)
+func (q *Query) Primary(v interface{}) *Query {
+	return q.Eq(MongoPrimaryName, v)
 }
 
-func (q *Query) any(t, k string, v interface{}) {
-	if !strings.HasPrefix(t, QueryOperationPrefix) {
-		t = QueryOperationPrefix + t
-	}
-	q.where = append(q.where, &Node{t: t, k: k, v: v})
+func (q *Query) any(t, k string, v interface{}) *Query {
+	q.where = append(q.where, NewNode(t, k, v))
+	return q
 }
 
 //Match 特殊匹配 or,not,and,nor
-func (this Query) match(t string, v ...*Node) {
+func (q *Query) match(t string, v ...*Node) *Query {
 	t = strings.TrimPrefix(t, QueryOperationPrefix)
-	this.complex[t] = append(this.complex[t], v...)
+	q.complex[t] = append(q.complex[t], v...)
+	return q
 }
 
 //Eq 等于（=）
-func (q *Query) Eq(k string, v interface{}) {
-	q.any("", k, v)
+func (q *Query) Eq(k string, v interface{}) *Query {
+	return q.any("", k, v)
 }
 
 //Gt 大于（>）
-func (q *Query) Gt(k string, v interface{}) {
-	q.any("$gt", k, v)
+func (q *Query) Gt(k string, v interface{}) *Query {
+	return q.any("$gt", k, v)
 }
 
 //Gte 大于等于（>=）
-func (q *Query) Gte(k string, v interface{}) {
-	q.any("$gte", k, v)
+func (q *Query) Gte(k string, v interface{}) *Query {
+	return q.any("$gte", k, v)
 }
 
 //Lt 小于（<）
-func (q *Query) Lt(k string, v interface{}) {
-	q.any("$lt", k, v)
+func (q *Query) Lt(k string, v interface{}) *Query {
+	return q.any("$lt", k, v)
 }
 
 //Lte 小于等于（<=）
-func (q *Query) Lte(k string, v interface{}) {
-	q.any("$lte", k, v)
+func (q *Query) Lte(k string, v interface{}) *Query {
+	return q.any("$lte", k, v)
+}
+
+// Between 范围查询 lo <= k <= hi,与同一字段的其他条件合并
+func (q *Query) Between(k string, lo, hi interface{}) *Query {
+	return q.any(queryOperationBetween, k, [2]interface{}{lo, hi})
 }
 
 //Ne 不等于（!=）
-func (q *Query) Ne(k string, v interface{}) {
-	q.any("$ne", k, v)
+func (q *Query) Ne(k string, v interface{}) *Query {
+	return q.any("$ne", k, v)
 }
 
 //In The $in operator selects the documents where the value of a field equals any value in the specified array
-func (q *Query) In(k string, v interface{}) {
-	q.any("$in", k, v)
+func (q *Query) In(k string, v interface{}) *Query {
+	return q.any("$in", k, v)
 }
 
 //Nin selects the documents where: the field value is not in the specified array or the field does not exist.
-func (q *Query) Nin(k string, v interface{}) {
-	q.any("$nin", k, v)
+func (q *Query) Nin(k string, v interface{}) *Query {
+	return q.any("$nin", k, v)
+}
+
+//Exists 字段是否存在,v=true 存在,v=false 不存在
+func (q *Query) Exists(k string, v bool) *Query {
+	return q.any("$exists", k, v)
+}
+
+//Regex 正则匹配,pattern 为正则表达式,用户输入请先使用 regexp.QuoteMeta 转义
+//options 正则选项,如 i(忽略大小写),m,x,s
+func (q *Query) Regex(k string, pattern string, options ...string) *Query {
+	return q.any("$regex", k, primitive.Regex{Pattern: pattern, Options: strings.Join(options, "")})
+}
+
+// Mod 取模匹配,字段值除以 divisor 余数为 remainder
+func (q *Query) Mod(k string, divisor, remainder interface{}) *Query {
+	return q.any("$mod", k, []interface{}{divisor, remainder})
+}
+
+// Size 数组长度等于n,$size 不支持范围查询,需要范围时请额外维护长度字段
+func (q *Query) Size(k string, n int) *Query {
+	return q.any("$size", k, n)
+}
+
+// Near 按距离由近到远返回 GeoJSON 点附近的文档,需要 2dsphere 索引
+// maxMeters 最大距离(米),<=0 时不限制
+// $near 自带距离排序,不能再对同一字段使用 Order
+func (q *Query) Near(k string, lng, lat float64, maxMeters float64) *Query {
+	near := bson.M{"$geometry": bson.M{"type": "Point", "coordinates": bson.A{lng, lat}}}
+	if maxMeters > 0 {
+		near["$maxDistance"] = maxMeters
+	}
+	return q.any("$near", k, near)
+}
+
+// GeoWithin 位于 geometry 范围内的文档,geometry 为 GeoJSON Polygon 或 MultiPolygon
+//
+//	bson.M{"type": "Polygon", "coordinates": bson.A{bson.A{bson.A{0, 0}, bson.A{0, 1}, bson.A{1, 1}, bson.A{0, 0}}}}
+func (q *Query) GeoWithin(k string, geometry interface{}) *Query {
+	return q.any("$geoWithin", k, bson.M{"$geometry": geometry})
+}
+
+// BitsAllSet 指定的位全部为1
+// mask 可以是整数位掩码(例如 5 表示第0位和第2位),也可以是位序号数组 []int{0, 2}
+func (q *Query) BitsAllSet(k string, mask interface{}) *Query {
+	return q.any("$bitsAllSet", k, mask)
+}
+
+// BitsAnySet 指定的位至少有一个为1,mask 同 BitsAllSet
+func (q *Query) BitsAnySet(k string, mask interface{}) *Query {
+	return q.any("$bitsAnySet", k, mask)
+}
+
+// BitsAllClear 指定的位全部为0,mask 同 BitsAllSet
+func (q *Query) BitsAllClear(k string, mask interface{}) *Query {
+	return q.any("$bitsAllClear", k, mask)
+}
+
+// BitsAnyClear 指定的位至少有一个为0,mask 同 BitsAllSet
+func (q *Query) BitsAnyClear(k string, mask interface{}) *Query {
+	return q.any("$bitsAnyClear", k, mask)
+}
+
+//ElemMatch 数组中至少有一个元素满足sub中的所有条件
+//sub 中的字段名使用数组元素对象的字段名
+func (q *Query) ElemMatch(k string, sub *Query) *Query {
+	return q.any("$elemMatch", k, sub)
+}
+
+// logic 逻辑组合,每个参数作为一个表达式
+// 参数可以是 *Node,*Query 或者 map[string]any(每个键值对相等匹配)
+func (q *Query) logic(t string, v ...any) *Query {
+	for _, i := range v {
+		switch x := i.(type) {
+		case *Node:
+			q.match(t, x)
+		case *Query:
+			q.match(t, NewNode("", "", x))
+		case Filter:
+			q.logic(t, map[string]any(x))
+		case bson.M:
+			q.logic(t, map[string]any(x))
+		case map[string]any:
+			sub := New()
+			for k, val := range x {
+				sub.Eq(k, val)
+			}
+			q.match(t, NewNode("", "", sub))
+		default:
+			q.err = fmt.Errorf("%w: unsupported %v expression %T", ErrInvalidWhere, t, i)
+		}
+	}
+	return q
+}
+
+// TextOption 全文检索选项
+type TextOption func(text bson.M)
+
+// TextLanguage 检索使用的语言,决定停用词和词干规则
+func TextLanguage(language string) TextOption {
+	return func(text bson.M) {
+		text["$language"] = language
+	}
+}
+
+// TextCaseSensitive 是否区分大小写
+func TextCaseSensitive(v bool) TextOption {
+	return func(text bson.M) {
+		text["$caseSensitive"] = v
+	}
+}
+
+// TextDiacriticSensitive 是否区分变音符号
+func TextDiacriticSensitive(v bool) TextOption {
+	return func(text bson.M) {
+		text["$diacriticSensitive"] = v
+	}
+}
+
+// TextSearch 使用文本索引全文检索,一个查询只能有一个 $text 条件
+func (q *Query) TextSearch(term string, opts ...TextOption) *Query {
+	for _, node := range q.where {
+		if node.t == queryOperationText {
+			q.err = fmt.Errorf("%w: $text can only be used once", ErrInvalidWhere)
+			return q
+		}
+	}
+	text := bson.M{"$search": term}
+	for _, f := range opts {
+		f(text)
+	}
+	q.where = append(q.where, NewNode(queryOperationText, "", text))
+	return q
 }
 
 //OR The $or operator performs a logical OR operation on an array of two or more <expressions> and selects the documents that satisfy at least one of the <expressions>.
-func (this Query) OR(v ...*Node) {
-	this.match("or", v...)
+func (q *Query) OR(v ...any) *Query {
+	return q.logic("or", v...)
 }
 
 //NOT $not performs a logical NOT operation on the specified <operator-expression> and selects the documents that do not match the <operator-expression>.
 //This includes documents that do not contain the field.
-func (this Query) NOT(v ...*Node) {
-	this.match("not", v...)
+func (q *Query) NOT(v ...any) *Query {
+	return q.logic("not", v...)
 }
 
 //AND $and performs a logical AND operation on an array of one or more expressions (e.g. <expression1>, <expression2>, etc.) and selects the documents that satisfy all the expressions in the array.
 //The $and operator uses short-circuit evaluation. If the first expression (e.g. <expression1>) evaluates to false, MongoDB will not evaluate the remaining expressions.
-func (this Query) AND(v ...*Node) {
-	this.match("and", v...)
+func (q *Query) AND(v ...any) *Query {
+	return q.logic("and", v...)
 }
 
 //NOR $nor performs a logical NOR operation on an array of one or more query expression and selects the documents that fail all the query expressions in the array.
-func (this Query) NOR(v ...*Node) {
-	this.match("nor", v...)
+func (q *Query) NOR(v ...any) *Query {
+	return q.logic("nor", v...)
 }
 
 func (q *Query) Marshal() ([]byte, error) {
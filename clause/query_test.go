@@ -1,7 +1,13 @@
 package clause
 
 import (
+	"errors"
+	"reflect"
 	"testing"
+
+	"github.com/hwcer/cosgo/schema"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 func TestQuery(t *testing.T) {
@@ -15,3 +21,464 @@ func TestQuery(t *testing.T) {
 
 	t.Logf("%v", query.String())
 }
+
+func TestQueryExists(t *testing.T) {
+	query := New()
+	query.Exists("email", true)
+	if filter := query.Build(nil); !reflect.DeepEqual(filter, Filter{"email": bson.M{"$exists": true}}) {
+		t.Fatalf("Exists build error:%v", filter)
+	}
+
+	query = New()
+	query.Exists("email", true)
+	query.Eq("email", "a@b.c")
+	want := Filter{"email": bson.M{"$exists": true, "$in": []interface{}{"a@b.c"}}}
+	if filter := query.Build(nil); !reflect.DeepEqual(filter, want) {
+		t.Fatalf("Exists with Eq build error:%v", filter)
+	}
+
+	filter := Filter{}
+	filter.Exists("email", false)
+	if !reflect.DeepEqual(filter, Filter{"email": bson.M{"$exists": false}}) {
+		t.Fatalf("Filter.Exists error:%v", filter)
+	}
+}
+
+func TestWhereIsNull(t *testing.T) {
+	cases := []struct {
+		where string
+		want  Filter
+	}{
+		{"phone IS NOT NULL", Filter{"phone": bson.M{"$ne": nil}}},
+		{"email IS NULL", Filter{"email": nil}},
+		{"email IS NULL AND phone IS NOT NULL", Filter{"email": nil, "phone": bson.M{"$ne": nil}}},
+		{"email IS NULL OR phone IS NOT NULL", Filter{"$or": []interface{}{
+			Filter{"email": nil},
+			Filter{"phone": bson.M{"$ne": nil}},
+		}}},
+	}
+	for _, c := range cases {
+		query := New()
+		query.Where(c.where)
+		if filter := query.Build(nil); !reflect.DeepEqual(filter, c.want) {
+			t.Fatalf("Where(%q) = %v, want %v", c.where, filter, c.want)
+		}
+	}
+}
+
+func TestWhereOperators(t *testing.T) {
+	cases := []struct {
+		where string
+		args  []interface{}
+		want  Filter
+	}{
+		{"name = ?", []interface{}{"x"}, Filter{"name": "x"}},
+		{"_id IN ?", []interface{}{[]int{1, 2}}, Filter{"_id": bson.M{"$in": []interface{}{1, 2}}}},
+		{"_id NIN ?", []interface{}{[]int{1, 2}}, Filter{"_id": bson.M{"$nin": []interface{}{1, 2}}}},
+		{"_id <> ?", []interface{}{[]int{3}}, Filter{"_id": bson.M{"$nin": []interface{}{3}}}},
+		{"lv >= ? AND lv < ?", []interface{}{1, 10}, Filter{"lv": bson.M{"$gte": 1, "$lt": 10}}},
+		{"name != ?", []interface{}{"x"}, Filter{"name": bson.M{"$ne": "x"}}},
+		{"status <> closed", nil, Filter{"status": bson.M{"$ne": "closed"}}},
+		{"_id != ?", []interface{}{[]int{1, 2}}, Filter{"_id": bson.M{"$nin": []interface{}{1, 2}}}},
+		{"_id != ?", []interface{}{primitive.ObjectID{1}}, Filter{"_id": bson.M{"$ne": primitive.ObjectID{1}}}},
+	}
+	for _, c := range cases {
+		query := New()
+		query.Where(c.where, c.args...)
+		if filter := query.Build(nil); !reflect.DeepEqual(filter, c.want) {
+			t.Fatalf("Where(%q) = %v, want %v", c.where, filter, c.want)
+		}
+	}
+}
+
+func TestWhereBetween(t *testing.T) {
+	cases := []struct {
+		where string
+		args  []interface{}
+		want  Filter
+	}{
+		{"age BETWEEN ? AND ?", []interface{}{18, 30}, Filter{"age": bson.M{"$gte": 18, "$lte": 30}}},
+		{"age BETWEEN 18 AND 30", nil, Filter{"age": bson.M{"$gte": "18", "$lte": "30"}}},
+		{"age BETWEEN ? AND 30", []interface{}{18}, Filter{"age": bson.M{"$gte": 18, "$lte": "30"}}},
+		{"age BETWEEN ? AND ? AND name = ?", []interface{}{18, 30, "x"}, Filter{"age": bson.M{"$gte": 18, "$lte": 30}, "name": "x"}},
+		{"name = ? OR age BETWEEN ? AND ?", []interface{}{"x", 18, 30}, Filter{"$or": []interface{}{Filter{"name": "x"}, Filter{"age": bson.M{"$gte": 18, "$lte": 30}}}}},
+	}
+	for _, c := range cases {
+		query := New()
+		query.Where(c.where, c.args...)
+		if filter := query.Build(nil); !reflect.DeepEqual(filter, c.want) {
+			t.Fatalf("Where(%q) = %v, want %v", c.where, filter, c.want)
+		}
+	}
+}
+
+type aliasUser struct {
+	Id   string `bson:"_id"`
+	Name string `bson:"name"`
+}
+
+func TestQueryAlias(t *testing.T) {
+	sch, err := schema.Parse(&aliasUser{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := New()
+	query.Alias(map[string]string{"userName": "Name"})
+	query.Where("userName = ?", "hwc")
+	if filter := query.Build(sch); !reflect.DeepEqual(filter, Filter{"name": "hwc"}) {
+		t.Fatalf("Alias build error:%v", filter)
+	}
+}
+
+func TestQueryRegex(t *testing.T) {
+	query := New()
+	query.Eq("name", "hwc")
+	query.Regex("name", "^hw", "i")
+	want := Filter{"name": bson.M{"$in": []interface{}{"hwc"}, "$regex": primitive.Regex{Pattern: "^hw", Options: "i"}}}
+	if filter := query.Build(nil); !reflect.DeepEqual(filter, want) {
+		t.Fatalf("Regex build error:%v", filter)
+	}
+
+	cases := map[string]string{
+		"abc%":  "^abc",
+		"%abc":  "abc$",
+		"%abc%": "abc",
+		"a_c":   "^a.c$",
+		"a.b*%": `^a\.b\*`,
+	}
+	for like, pattern := range cases {
+		query = New()
+		query.Where("name LIKE ?", like)
+		want = Filter{"name": bson.M{"$regex": primitive.Regex{Pattern: pattern}}}
+		if filter := query.Build(nil); !reflect.DeepEqual(filter, want) {
+			t.Fatalf("LIKE %q build error:%v", like, filter)
+		}
+	}
+	//LIKE 参数缺失或者不是字符串
+	for _, args := range [][]interface{}{nil, {nil}, {1}} {
+		query = New()
+		if query.Where("name LIKE ?", args...); !errors.Is(query.Err(), ErrInvalidWhere) {
+			t.Fatalf("LIKE %v err = %v, want ErrInvalidWhere", args, query.Err())
+		}
+	}
+}
+
+type nestedAddress struct {
+	City string `bson:"city"`
+}
+
+type nestedProfile struct {
+	Email   string        `bson:"email"`
+	Address nestedAddress `bson:"addr"`
+}
+
+type nestedUser struct {
+	Id      string        `bson:"_id"`
+	Profile nestedProfile `bson:"profile"`
+}
+
+func TestQueryNestedField(t *testing.T) {
+	sch, err := schema.Parse(&nestedUser{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range []string{"Profile.Email", "profile.email", "Profile.email"} {
+		query := New()
+		query.Eq(k, "a@b.c")
+		if filter := query.Build(sch); !reflect.DeepEqual(filter, Filter{"profile.email": "a@b.c"}) {
+			t.Fatalf("nested field %v build error:%v", k, filter)
+		}
+	}
+	if k := DBName(sch, "Profile.Address.City"); k != "profile.addr.city" {
+		t.Fatalf("two-level nested field error:%v", k)
+	}
+	if k := DBName(sch, "profile.Address.Unknown"); k != "profile.addr.Unknown" {
+		t.Fatalf("two-level nested fallback error:%v", k)
+	}
+	if k := DBName(sch, "Profile.Unknown.X"); k != "profile.Unknown.X" {
+		t.Fatalf("nested field fallback error:%v", k)
+	}
+}
+
+type elemAttr struct {
+	Key string `bson:"key"`
+	Val int    `bson:"val"`
+}
+
+type elemItem struct {
+	Type  string      `bson:"type"`
+	Level int         `bson:"level"`
+	Attrs []*elemAttr `bson:"attrs"`
+}
+
+type elemRole struct {
+	Id    string      `bson:"_id"`
+	Items []*elemItem `bson:"items"`
+}
+
+func TestQueryElemMatch(t *testing.T) {
+	sub := New()
+	sub.Eq("type", "weapon")
+	sub.Gte("level", 5)
+	query := New()
+	query.ElemMatch("items", sub)
+	want := Filter{"items": bson.M{"$elemMatch": Filter{"type": "weapon", "level": bson.M{"$gte": 5}}}}
+	if filter := query.Build(nil); !reflect.DeepEqual(filter, want) {
+		t.Fatalf("ElemMatch build error:%v", filter)
+	}
+
+	sch, err := schema.Parse(&elemRole{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	attr := New()
+	attr.Eq("Key", "atk")
+	sub = New()
+	sub.Eq("Type", "weapon")
+	sub.ElemMatch("Attrs", attr)
+	query = New()
+	query.ElemMatch("Items", sub)
+	want = Filter{"items": bson.M{"$elemMatch": Filter{"type": "weapon", "attrs": bson.M{"$elemMatch": Filter{"key": "atk"}}}}}
+	if filter := query.Build(sch); !reflect.DeepEqual(filter, want) {
+		t.Fatalf("nested ElemMatch build error:%v", filter)
+	}
+}
+
+func TestWhereArgsOrder(t *testing.T) {
+	cases := []struct {
+		where string
+		args  []interface{}
+		want  Filter
+	}{
+		{"status = active OR age > ?", []interface{}{18}, Filter{"$or": []interface{}{Filter{"status": "active"}, Filter{"age": bson.M{"$gt": 18}}}}},
+		{"age > ? OR status = active OR lv < ?", []interface{}{18, 5}, Filter{"$or": []interface{}{Filter{"age": bson.M{"$gt": 18}}, Filter{"status": "active"}, Filter{"lv": bson.M{"$lt": 5}}}}},
+		{"url = a?b OR name = ?", []interface{}{"x"}, Filter{"$or": []interface{}{Filter{"url": "a?b"}, Filter{"name": "x"}}}},
+		{"email IS NULL OR name = ? OR age BETWEEN 1 AND ?", []interface{}{"x", 30}, Filter{"$or": []interface{}{
+			Filter{"email": nil},
+			Filter{"name": "x"},
+			Filter{"age": bson.M{"$gte": "1", "$lte": 30}},
+		}}},
+	}
+	for _, c := range cases {
+		query := New()
+		query.Where(c.where, c.args...)
+		if filter := query.Build(nil); !reflect.DeepEqual(filter, c.want) {
+			t.Fatalf("Where(%q) = %v, want %v", c.where, filter, c.want)
+		}
+	}
+}
+
+func TestWhereErr(t *testing.T) {
+	for _, format := range []interface{}{nil, func() {}, make(chan int), map[int]int{1: 1}, "name ~ ?", "name = ? OR lv"} {
+		query := New()
+		query.Where(format, 1)
+		if !errors.Is(query.Err(), ErrInvalidWhere) {
+			t.Fatalf("Where(%v) err = %v, want ErrInvalidWhere", format, query.Err())
+		}
+	}
+	query := New()
+	query.Where("name = ?", "x")
+	query.Where(1)
+	query.Where([]int{1, 2})
+	query.Where(map[string]any{"lv": 1})
+	if err := query.Err(); err != nil {
+		t.Fatalf("valid Where err:%v", err)
+	}
+}
+
+func TestQueryChain(t *testing.T) {
+	filter := New().Primary(1).Gte("lv", 5).Lt("lv", 10).Ne("status", "closed").Exists("email", true).Build(nil)
+	want := Filter{
+		"_id":    1,
+		"lv":     bson.M{"$gte": 5, "$lt": 10},
+		"status": bson.M{"$ne": "closed"},
+		"email":  bson.M{"$exists": true},
+	}
+	if !reflect.DeepEqual(filter, want) {
+		t.Fatalf("chained build = %v, want %v", filter, want)
+	}
+}
+
+func TestQueryInFlatten(t *testing.T) {
+	want := Filter{"_id": bson.M{"$in": []interface{}{1, 2}}}
+	for _, v := range []interface{}{[]int{1, 2}, []interface{}{1, 2}, []interface{}{[]int{1, 2}}} {
+		if filter := New().In("_id", v).Build(nil); !reflect.DeepEqual(filter, want) {
+			t.Fatalf("In(%v) = %v, want %v", v, filter, want)
+		}
+	}
+	want = Filter{"name": bson.M{"$in": []interface{}{"a", "b"}}}
+	for _, v := range []interface{}{[]string{"a", "b"}, []interface{}{[]string{"a", "b"}}} {
+		if filter := New().In("name", v).Build(nil); !reflect.DeepEqual(filter, want) {
+			t.Fatalf("In(%v) = %v, want %v", v, filter, want)
+		}
+	}
+	filter := Filter{}
+	filter.Nin("_id", []int{1, 2})
+	if !reflect.DeepEqual(filter, Filter{"_id": bson.M{"$nin": []interface{}{1, 2}}}) {
+		t.Fatalf("Filter.Nin error:%v", filter)
+	}
+}
+
+func TestQueryClone(t *testing.T) {
+	base := New().Eq("status", "active").ElemMatch("items", New().Eq("type", "weapon"))
+	base.OR(&Node{t: "$", k: "lv", v: 1})
+	want := base.Build(nil)
+
+	clone := base.Clone()
+	clone.Gte("lv", 10)
+	clone.OR(&Node{t: "$", k: "lv", v: 2})
+	clone.where[0].v = "closed"
+	clone.where[1].v.(*Query).Eq("level", 5)
+	if filter := base.Build(nil); !reflect.DeepEqual(filter, want) {
+		t.Fatalf("base changed after clone: %v, want %v", filter, want)
+	}
+	wantClone := Filter{
+		"status": "closed",
+		"items":  bson.M{"$elemMatch": Filter{"type": "weapon", "level": 5}},
+		"lv":     bson.M{"$gte": 10},
+		"$or":    []interface{}{Filter{"lv": 1}, Filter{"lv": 2}},
+	}
+	if filter := clone.Build(nil); !reflect.DeepEqual(filter, wantClone) {
+		t.Fatalf("clone build = %v, want %v", filter, wantClone)
+	}
+}
+
+func TestQueryLogic(t *testing.T) {
+	query := New()
+	query.OR(map[string]any{"name": "a"}, bson.M{"name": "b"})
+	want := Filter{"$or": []interface{}{Filter{"name": "a"}, Filter{"name": "b"}}}
+	if filter := query.Build(nil); !reflect.DeepEqual(filter, want) {
+		t.Fatalf("OR maps = %v, want %v", filter, want)
+	}
+
+	sch, err := schema.Parse(&aliasUser{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	query = New().Eq("Id", "1")
+	query.AND(New().Gte("Name", "a").Lt("Name", "c"), Filter{"Name": "b"})
+	query.NOR(New().Eq("Name", "x"))
+	want = Filter{
+		"_id":  "1",
+		"$and": []interface{}{Filter{"name": bson.M{"$gte": "a", "$lt": "c"}}, Filter{"name": "b"}},
+		"$nor": []interface{}{Filter{"name": "x"}},
+	}
+	if filter := query.Build(sch); !reflect.DeepEqual(filter, want) {
+		t.Fatalf("AND/NOR queries = %v, want %v", filter, want)
+	}
+
+	if query = New().OR("name = a"); !errors.Is(query.Err(), ErrInvalidWhere) {
+		t.Fatalf("OR unsupported expression err:%v", query.Err())
+	}
+}
+
+func TestNewNode(t *testing.T) {
+	query := New()
+	query.OR(NewNode("", "name", "a"), NewNode("gt", "lv", 5), NewNode("$in", "_id", []int{1, 2}))
+	want := Filter{"$or": []interface{}{
+		Filter{"name": "a"},
+		Filter{"lv": bson.M{"$gt": 5}},
+		Filter{"_id": bson.M{"$in": []interface{}{1, 2}}},
+	}}
+	if filter := query.Build(nil); !reflect.DeepEqual(filter, want) {
+		t.Fatalf("OR nodes = %v, want %v", filter, want)
+	}
+}
+
+func TestTextSearch(t *testing.T) {
+	query := New().TextSearch("coffee shop", TextLanguage("en"), TextCaseSensitive(true)).Eq("status", "active")
+	want := Filter{
+		"$text":  bson.M{"$search": "coffee shop", "$language": "en", "$caseSensitive": true},
+		"status": "active",
+	}
+	if filter := query.Build(nil); !reflect.DeepEqual(filter, want) {
+		t.Fatalf("TextSearch = %v, want %v", filter, want)
+	}
+	if query.TextSearch("tea"); !errors.Is(query.Err(), ErrInvalidWhere) {
+		t.Fatalf("duplicate TextSearch err:%v", query.Err())
+	}
+}
+
+func TestQueryModSize(t *testing.T) {
+	query := New().Mod("lv", 4, 0).Size("tags", 2).Gte("lv", 8)
+	want := Filter{
+		"lv":   bson.M{"$mod": []interface{}{4, 0}, "$gte": 8},
+		"tags": bson.M{"$size": 2},
+	}
+	if filter := query.Build(nil); !reflect.DeepEqual(filter, want) {
+		t.Fatalf("Mod/Size build = %v, want %v", filter, want)
+	}
+	filter := Filter{}
+	filter.Mod("lv", 3, 1)
+	filter.Size("tags", 0)
+	if !reflect.DeepEqual(filter, Filter{"lv": bson.M{"$mod": []interface{}{3, 1}}, "tags": bson.M{"$size": 0}}) {
+		t.Fatalf("Filter Mod/Size error:%v", filter)
+	}
+}
+
+func TestQueryGeo(t *testing.T) {
+	query := New().Near("loc", 113.9, 22.5, 500)
+	want := Filter{"loc": bson.M{"$near": bson.M{
+		"$geometry":    bson.M{"type": "Point", "coordinates": bson.A{113.9, 22.5}},
+		"$maxDistance": float64(500),
+	}}}
+	if filter := query.Build(nil); !reflect.DeepEqual(filter, want) {
+		t.Fatalf("Near build = %v, want %v", filter, want)
+	}
+	if filter := New().Near("loc", 1, 2, 0).Build(nil); !reflect.DeepEqual(filter, Filter{"loc": bson.M{"$near": bson.M{
+		"$geometry": bson.M{"type": "Point", "coordinates": bson.A{float64(1), float64(2)}},
+	}}}) {
+		t.Fatalf("Near without max distance error:%v", filter)
+	}
+
+	polygon := bson.M{"type": "Polygon", "coordinates": bson.A{bson.A{bson.A{0, 0}, bson.A{0, 1}, bson.A{1, 1}, bson.A{0, 0}}}}
+	query = New().GeoWithin("loc", polygon).Eq("status", "open")
+	want = Filter{"loc": bson.M{"$geoWithin": bson.M{"$geometry": polygon}}, "status": "open"}
+	if filter := query.Build(nil); !reflect.DeepEqual(filter, want) {
+		t.Fatalf("GeoWithin build = %v, want %v", filter, want)
+	}
+}
+
+func TestQueryBits(t *testing.T) {
+	query := New().BitsAllSet("flags", 5).BitsAnyClear("flags", []int{1, 3})
+	query.BitsAnySet("perm", 0x10).BitsAllClear("perm", []int{0})
+	want := Filter{
+		"flags": bson.M{"$bitsAllSet": 5, "$bitsAnyClear": []int{1, 3}},
+		"perm":  bson.M{"$bitsAnySet": 0x10, "$bitsAllClear": []int{0}},
+	}
+	if filter := query.Build(nil); !reflect.DeepEqual(filter, want) {
+		t.Fatalf("bits build = %v, want %v", filter, want)
+	}
+	filter := Filter{}
+	filter.BitsAllSet("flags", []int{0, 2})
+	filter.BitsAnySet("flags", 2)
+	filter.BitsAllClear("perm", 1)
+	filter.BitsAnyClear("perm", 6)
+	want = Filter{
+		"flags": bson.M{"$bitsAllSet": []int{0, 2}, "$bitsAnySet": 2},
+		"perm":  bson.M{"$bitsAllClear": 1, "$bitsAnyClear": 6},
+	}
+	if !reflect.DeepEqual(filter, want) {
+		t.Fatalf("Filter bits = %v, want %v", filter, want)
+	}
+}
+
+func TestQueryBetween(t *testing.T) {
+	want := Filter{"lv": bson.M{"$gte": 1, "$lte": 10, "$gt": 2}, "name": "x"}
+	if filter := New().Eq("name", "x").Between("lv", 1, 10).Gt("lv", 2).Build(nil); !reflect.DeepEqual(filter, want) {
+		t.Fatalf("Query.Between = %v, want %v", filter, want)
+	}
+	filter := Filter{}
+	filter.Between("lv", 1, 10)
+	filter.Gt("lv", 2)
+	if !reflect.DeepEqual(filter, Filter{"lv": bson.M{"$gte": 1, "$lte": 10, "$gt": 2}}) {
+		t.Fatalf("Filter.Between error:%v", filter)
+	}
+	//Eq 之后的范围条件合并到 $in
+	filter = Filter{}
+	filter.Eq("lv", 5)
+	filter.Between("lv", 1, 10)
+	if !reflect.DeepEqual(filter, Filter{"lv": bson.M{"$in": []interface{}{5}, "$gte": 1, "$lte": 10}}) {
+		t.Fatalf("Eq with Between error:%v", filter)
+	}
+}
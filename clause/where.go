@@ -2,17 +2,20 @@ package clause
 
 import (
 	"fmt"
+	"github.com/hwcer/cosmo/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"reflect"
+	"regexp"
 	"strings"
 )
 
 const sqlConditionSplit = " " //SQL语法分隔符
 
 //Where 构造查询条件
-//支持 =,>,<,>=,<=,<>,!=
+//支持 =,>,<,>=,<=,<>,!=,IS NULL,IS NOT NULL,LIKE,BETWEEN
 //支持使用OR,AND,NOT,NOR连接多个条件，OR,AND,NOT,NOR一次只能拼接一种
 var whereComplexMap = make(map[string]string)
-var whereConditionArr = []string{"NIN", "IN", "!=", "<>", ">=", "<=", ">", "<", "="}
+var whereConditionArr = []string{"BETWEEN", "IS NOT NULL", "IS NULL", "LIKE", "NIN", "IN", "!=", "<>", ">=", "<=", ">", "<", "="}
 var whereConditionSql = make(map[string]string)
 var whereConditionMongo = map[string]string{
 	"=":   "",
@@ -24,6 +27,30 @@ var whereConditionMongo = map[string]string{
 	"<":   "lt",
 	"IN":  "in",
 	"NIN": "nin",
+
+	"LIKE": "regex",
+
+	"BETWEEN": "between",
+
+	"IS NULL":     "",
+	"IS NOT NULL": "ne",
+}
+
+const (
+	whereConditionNotNull     = "IS NOT NULL"
+	whereConditionNotNullMask = "IS\x00NOT\x00NULL"
+	whereBetweenAnd           = " AND "
+	whereBetweenAndMask       = "\x00AND\x00"
+)
+
+// whereBetween BETWEEN lo AND hi 中的 AND 不是连接符
+var whereBetween = regexp.MustCompile(`BETWEEN\s+(\S+)\s+AND\s+`)
+
+// whereConditionValue 不需要参数的条件,使用固定值
+// 和 SQL 一致,IS NULL 匹配值为 null 或者字段不存在,IS NOT NULL 匹配字段存在并且值不为 null
+var whereConditionValue = map[string]interface{}{
+	"IS NULL":     nil,
+	"IS NOT NULL": nil,
 }
 
 func init() {
@@ -49,9 +76,13 @@ func IsQueryFormat(s string) bool {
 }
 
 func (q *Query) fromMap(i reflect.Value) (query string, args []interface{}) {
+	if i.Type().Key().Kind() != reflect.String {
+		q.err = fmt.Errorf("%w: map key must be string, got %v", ErrInvalidWhere, i.Type())
+		return
+	}
 	var pairs []string
 	for _, key := range i.MapKeys() {
-		pairs = append(pairs, fmt.Sprintf("%v = ?", key.Interface().(string)))
+		pairs = append(pairs, fmt.Sprintf("%v = ?", key.String()))
 		args = append(args, i.MapIndex(key).Interface())
 	}
 	query = strings.Join(pairs, whereComplexMap[QueryOperationAND])
@@ -66,14 +97,23 @@ func (q *Query) Where(format interface{}, cons ...interface{}) {
 	switch vof.Kind() {
 	case reflect.String:
 		args = cons
-		query = format.(string)
+		query = vof.String()
 	case reflect.Map:
-		query, args = q.fromMap(vof)
+		if query, args = q.fromMap(vof); q.err != nil {
+			return
+		}
+	case reflect.Invalid, reflect.Func, reflect.Chan, reflect.UnsafePointer, reflect.Complex64, reflect.Complex128:
+		q.err = fmt.Errorf("%w: unsupported format %T", ErrInvalidWhere, format)
+		return
 	default:
 		args = cons
 	}
 	//query 非查询语句时，使用主键匹配
 	if !IsQueryFormat(query) {
+		if wherePlaceholders(query) > 0 {
+			q.err = fmt.Errorf("%w: %q", ErrInvalidWhere, query)
+			return
+		}
 		args = append([]interface{}{format}, args...)
 		if vof.Kind() == reflect.Slice || vof.Kind() == reflect.Array {
 			query = MongoPrimaryName + " IN ?"
@@ -82,6 +122,10 @@ func (q *Query) Where(format interface{}, cons ...interface{}) {
 		}
 	}
 
+	//IS NOT NULL 中的 NOT 和 BETWEEN 中的 AND 不是连接符,查找连接符前先屏蔽
+	query = strings.ReplaceAll(query, whereConditionNotNull, whereConditionNotNullMask)
+	query = whereBetween.ReplaceAllString(query, "BETWEEN ${1}"+whereBetweenAndMask)
+
 	var arr []string
 	var whereType string
 	for _, k := range complexCondition {
@@ -100,20 +144,31 @@ func (q *Query) Where(format interface{}, cons ...interface{}) {
 	var argIndex int = 0
 
 	for _, pair := range arr {
-		var v interface{}
-		if strings.Contains(pair, "?") && argIndex < len(args) {
-			v = args[argIndex]
+		pair = strings.ReplaceAll(pair, whereConditionNotNullMask, whereConditionNotNull)
+		pair = strings.ReplaceAll(pair, whereBetweenAndMask, whereBetweenAnd)
+		//整个语句中的 ? 从左到右依次使用一个参数,没有占位符的条件不消耗参数
+		var v []interface{}
+		for i := wherePlaceholders(pair); i > 0 && argIndex < len(args); i-- {
+			v = append(v, args[argIndex])
 			argIndex += 1
 		}
+		var node *Node
 		for _, w := range whereConditionArr {
 			//fmt.Printf("Where pair: %v,w:%v, sql:%v \n", pair, w, whereConditionSql[w])
-			if strings.Contains(pair, whereConditionSql[w]) {
-				if node := parseWherePair(pair, w, v); node != nil {
-					nodes = append(nodes, node)
-				}
+			s := pair
+			if _, ok := whereConditionValue[w]; ok {
+				s += sqlConditionSplit //无参数条件位于末尾,没有后置分隔符
+			}
+			if strings.Contains(s, whereConditionSql[w]) {
+				node = parseWherePair(pair, w, v)
 				break
 			}
 		}
+		if node == nil {
+			q.err = fmt.Errorf("%w: %q", ErrInvalidWhere, pair)
+			return
+		}
+		nodes = append(nodes, node)
 	}
 	if whereType == QueryOperationAND {
 		q.where = append(q.where, nodes...)
@@ -122,23 +177,83 @@ func (q *Query) Where(format interface{}, cons ...interface{}) {
 	}
 }
 
-func parseWherePair(pair string, w string, v interface{}) *Node {
+// wherePlaceholders 条件中独立的 ? 占位符数量,字面值中包含的 ? 不计算在内
+func wherePlaceholders(pair string) (n int) {
+	for _, s := range strings.Fields(pair) {
+		if s == "?" {
+			n++
+		}
+	}
+	return
+}
+
+func parseWherePair(pair string, w string, args []interface{}) *Node {
 	//fmt.Printf("parseWherePair %v---%v ---%v\n", pair, w, v)
 	arr := strings.Split(pair, w)
 	//fmt.Printf("parseWherePair ARR: %v \n", arr)
 	if len(arr) != 2 {
 		return nil
 	}
-	node := &Node{}
-	node.t = QueryOperationPrefix + whereConditionMongo[w]
-	node.k = strings.Trim(arr[0], sqlConditionSplit)
+	node := NewNode(whereConditionMongo[w], strings.Trim(arr[0], sqlConditionSplit), nil)
+	value := func(s string) interface{} {
+		if s = strings.Trim(s, sqlConditionSplit); s != "?" {
+			return s
+		}
+		if len(args) == 0 {
+			return nil
+		}
+		v := args[0]
+		args = args[1:]
+		return v
+	}
 
 	var r interface{}
-	r = strings.Trim(arr[1], sqlConditionSplit)
-	if r == "?" {
-		r = v
+	if fixed, ok := whereConditionValue[w]; ok {
+		r = fixed
+	} else if w == "BETWEEN" {
+		bounds := strings.Split(arr[1], whereBetweenAnd)
+		if len(bounds) != 2 {
+			return nil
+		}
+		r = [2]interface{}{value(bounds[0]), value(bounds[1])}
+	} else {
+		r = value(arr[1])
+	}
+	if w == "LIKE" {
+		//LIKE 只接受字符串模式
+		like, ok := r.(string)
+		if !ok {
+			return nil
+		}
+		r = likeToRegex(like)
+	}
+	//不等于单个值时使用 $ne,数组时使用 $nin
+	if (w == "!=" || w == "<>") && !utils.IsArray(reflect.Indirect(reflect.ValueOf(r))) {
+		node.t = QueryOperationPrefix + "ne"
 	}
 	node.v = r
 	//fmt.Printf("parseWherePair node: %+v \n", node)
 	return node
 }
+
+// likeToRegex 将 LIKE 表达式转换成区分大小写的正则,需要忽略大小写时使用 Regex
+// % 匹配任意字符,_ 匹配单个字符,其他正则元字符全部转义
+func likeToRegex(s string) primitive.Regex {
+	var b strings.Builder
+	b.WriteString("^")
+	for _, c := range s {
+		switch c {
+		case '%':
+			b.WriteString(".*")
+		case '_':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	//去掉首尾多余的 .* 保持前缀匹配可以使用索引
+	pattern := strings.TrimPrefix(b.String(), "^.*")
+	pattern = strings.TrimSuffix(pattern, ".*$")
+	return primitive.Regex{Pattern: pattern}
+}
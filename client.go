@@ -43,23 +43,103 @@ read preference
 	5）nearest：最邻近节点，读操作在最邻近的成员，可能是主节点或者从节点。
 */
 func NewClient(address string, opts ...*options.ClientOptions) (client *mongo.Client, err error) {
-	if !strings.HasPrefix(address, "mongodb") {
-		address = "mongodb://" + address
-	}
-	c := options.Client().ApplyURI(address)
-	c.SetSocketTimeout(time.Second * 5)
-	c.SetConnectTimeout(time.Second * 10)
-	c.SetServerSelectionTimeout(time.Second * 10)
+	return NewClientWithConfig(address, nil, opts...)
+}
+
+// NewClientWithConfig 使用 ClientConfig 创建客户端,config 为nil 或者零值字段使用 DefaultClientConfig
+func NewClientWithConfig(address string, config *ClientConfig, opts ...*options.ClientOptions) (client *mongo.Client, err error) {
+	c := config.Options(address)
 	client, err = mongo.Connect(context.Background(), append([]*options.ClientOptions{c}, opts...)...)
 	if err != nil {
 		return
 	}
-	if err = client.Ping(context.Background(), readpref.Primary()); err != nil {
+	//使用客户端的读偏好检查连接,secondary 模式下不要求主节点可用
+	if err = client.Ping(context.Background(), nil); err != nil {
 		return
 	}
 	return
 }
 
+// DefaultClientConfig 默认客户端配置
+var DefaultClientConfig = ClientConfig{
+	SocketTimeout:          time.Second * 5,
+	ConnectTimeout:         time.Second * 10,
+	ServerSelectionTimeout: time.Second * 10,
+}
+
+// ClientConfig 客户端连接池,超时和读偏好设置,零值字段使用 DefaultClientConfig
+// 连接字符串中明确设置的参数优先,例如 ?readPreference=secondary&maxPoolSize=50
+type ClientConfig struct {
+	MinPoolSize            uint64
+	MaxPoolSize            uint64
+	MaxConnIdleTime        time.Duration
+	SocketTimeout          time.Duration
+	ConnectTimeout         time.Duration
+	ServerSelectionTimeout time.Duration
+	ReadPreference         readpref.Mode //读偏好,例如 readpref.SecondaryPreferredMode
+}
+
+// Options 解析连接字符串并合并配置
+func (this *ClientConfig) Options(address string) *options.ClientOptions {
+	if !strings.HasPrefix(address, "mongodb") {
+		address = "mongodb://" + address
+	}
+	config := DefaultClientConfig
+	if this != nil {
+		config.merge(this)
+	}
+	opts := options.Client().ApplyURI(address)
+	if opts.MinPoolSize == nil && config.MinPoolSize > 0 {
+		opts.SetMinPoolSize(config.MinPoolSize)
+	}
+	if opts.MaxPoolSize == nil && config.MaxPoolSize > 0 {
+		opts.SetMaxPoolSize(config.MaxPoolSize)
+	}
+	if opts.MaxConnIdleTime == nil && config.MaxConnIdleTime > 0 {
+		opts.SetMaxConnIdleTime(config.MaxConnIdleTime)
+	}
+	if opts.SocketTimeout == nil && config.SocketTimeout > 0 {
+		opts.SetSocketTimeout(config.SocketTimeout)
+	}
+	if opts.ConnectTimeout == nil && config.ConnectTimeout > 0 {
+		opts.SetConnectTimeout(config.ConnectTimeout)
+	}
+	if opts.ServerSelectionTimeout == nil && config.ServerSelectionTimeout > 0 {
+		opts.SetServerSelectionTimeout(config.ServerSelectionTimeout)
+	}
+	if opts.ReadPreference == nil && config.ReadPreference > 0 {
+		if rp, err := readpref.New(config.ReadPreference); err == nil {
+			opts.SetReadPreference(rp)
+		}
+	}
+	return opts
+}
+
+// merge 使用c中的非零值覆盖
+func (this *ClientConfig) merge(c *ClientConfig) {
+	if c.MinPoolSize > 0 {
+		this.MinPoolSize = c.MinPoolSize
+	}
+	if c.MaxPoolSize > 0 {
+		this.MaxPoolSize = c.MaxPoolSize
+	}
+	if c.MaxConnIdleTime > 0 {
+		this.MaxConnIdleTime = c.MaxConnIdleTime
+	}
+	if c.SocketTimeout > 0 {
+		this.SocketTimeout = c.SocketTimeout
+	}
+	if c.ConnectTimeout > 0 {
+		this.ConnectTimeout = c.ConnectTimeout
+	}
+	if c.ServerSelectionTimeout > 0 {
+		this.ServerSelectionTimeout = c.ServerSelectionTimeout
+	}
+	if c.ReadPreference > 0 {
+		this.ReadPreference = c.ReadPreference
+	}
+}
+
 func NewClientOptions() *options.ClientOptions {
 	opts := &options.ClientOptions{}
 	return opts
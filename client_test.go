@@ -0,0 +1,83 @@
+package cosmo
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
+	"go.mongodb.org/mongo-driver/bson/bsonrw"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testMoney 自定义类型,以分为单位保存为int64
+type testMoney struct {
+	cents int64
+}
+
+type testWallet struct {
+	Id      int       `bson:"_id"`
+	Balance testMoney `bson:"balance"`
+}
+
+func testRegistry() *bsoncodec.Registry {
+	t := reflect.TypeOf(testMoney{})
+	registry := bson.NewRegistry()
+	registry.RegisterTypeEncoder(t, bsoncodec.ValueEncoderFunc(func(_ bsoncodec.EncodeContext, vw bsonrw.ValueWriter, v reflect.Value) error {
+		return vw.WriteInt64(v.Interface().(testMoney).cents)
+	}))
+	registry.RegisterTypeDecoder(t, bsoncodec.ValueDecoderFunc(func(_ bsoncodec.DecodeContext, vr bsonrw.ValueReader, v reflect.Value) error {
+		i, err := vr.ReadInt64()
+		if err == nil {
+			v.Set(reflect.ValueOf(testMoney{cents: i}))
+		}
+		return err
+	}))
+	return registry
+}
+
+func TestClientRegistry(t *testing.T) {
+	newTestDB(t)
+	db := New()
+	if err := db.Start("cosmo_test", testAddress, options.Client().SetRegistry(testRegistry())); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.Model(&testWallet{}).Delete(1)
+	if tx := db.Create(&testWallet{Id: 1, Balance: testMoney{cents: 1250}}); tx.Error != nil {
+		t.Fatal(tx.Error)
+	}
+	wallet := &testWallet{}
+	if tx := db.Find(wallet, 1); tx.Error != nil {
+		t.Fatal(tx.Error)
+	} else if wallet.Balance.cents != 1250 {
+		t.Fatalf("custom registry round trip error:%+v", wallet)
+	}
+}
+
+func TestClientConfig(t *testing.T) {
+	opts := (&ClientConfig{MaxPoolSize: 16, ReadPreference: readpref.SecondaryPreferredMode}).Options(testAddress)
+	if opts.MaxPoolSize == nil || *opts.MaxPoolSize != 16 {
+		t.Fatalf("MaxPoolSize error:%v", opts.MaxPoolSize)
+	}
+	if opts.ReadPreference == nil || opts.ReadPreference.Mode() != readpref.SecondaryPreferredMode {
+		t.Fatalf("ReadPreference error:%v", opts.ReadPreference)
+	}
+	//零值字段使用默认配置
+	if opts.ConnectTimeout == nil || *opts.ConnectTimeout != DefaultClientConfig.ConnectTimeout {
+		t.Fatalf("ConnectTimeout error:%v", opts.ConnectTimeout)
+	}
+	//连接字符串中的参数优先
+	opts = (&ClientConfig{MaxPoolSize: 16, ConnectTimeout: time.Second}).Options("mongodb://" + testAddress + "/?readPreference=secondary&maxPoolSize=50")
+	if opts.ReadPreference == nil || opts.ReadPreference.Mode() != readpref.SecondaryMode {
+		t.Fatalf("URI ReadPreference overridden:%v", opts.ReadPreference)
+	}
+	if *opts.MaxPoolSize != 50 || *opts.ConnectTimeout != time.Second {
+		t.Fatalf("URI MaxPoolSize error:%v,%v", *opts.MaxPoolSize, *opts.ConnectTimeout)
+	}
+	var nilConfig *ClientConfig
+	if opts = nilConfig.Options(testAddress); opts.ReadPreference != nil || opts.MaxPoolSize != nil {
+		t.Fatalf("nil config error:%v,%v", opts.ReadPreference, opts.MaxPoolSize)
+	}
+}
@@ -2,8 +2,11 @@ package cosmo
 
 import (
 	"errors"
+	"fmt"
+	"github.com/hwcer/cosgo/schema"
 	"github.com/hwcer/cosmo/clause"
 	"github.com/hwcer/cosmo/update"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"reflect"
@@ -11,22 +14,27 @@ import (
 
 // Create insert the value into dbname
 func cmdCreate(tx *DB) (err error) {
-	coll := tx.client.Database(tx.dbname).Collection(tx.statement.table)
+	if err = createDefaults(tx.statement); err != nil {
+		return
+	}
+	autoCreateTime(tx.statement)
+	coll := tx.statement.collection()
 	switch tx.statement.reflectValue.Kind() {
 	case reflect.Map, reflect.Struct:
 		opts := options.InsertOne()
-		if _, err = coll.InsertOne(tx.statement.Context, tx.statement.value, opts); err == nil {
+		var result *mongo.InsertOneResult
+		if result, err = coll.InsertOne(tx.statement.Context, tx.statement.value, opts); err == nil {
 			tx.RowsAffected = 1
+			tx.LastInsertID = result.InsertedID
 		}
 	case reflect.Array, reflect.Slice:
-		opts := options.InsertMany()
-		var documents []interface{}
-		for i := 0; i < tx.statement.reflectValue.Len(); i++ {
-			documents = append(documents, tx.statement.reflectValue.Index(i).Interface())
-		}
-		var result *mongo.InsertManyResult
-		if result, err = coll.InsertMany(tx.statement.Context, documents, opts); err == nil {
-			tx.RowsAffected = int64(len(result.InsertedIDs))
+		for i, b := range createBatches(tx.statement.reflectValue.Len(), tx.statement.batchSize) {
+			if err = insertMany(tx, coll, b[0], b[1]); err != nil {
+				if tx.statement.batchSize > 0 {
+					err = fmt.Errorf("create batch %d [%d,%d) error: %w", i, b[0], b[1], err)
+				}
+				return
+			}
 		}
 	default:
 		panic("unhandled default case")
@@ -34,30 +42,64 @@ func cmdCreate(tx *DB) (err error) {
 	return
 }
 
+// createBatches 将n条记录按size分批,size<=0 时不分批
+func createBatches(n, size int) (r [][2]int) {
+	if size <= 0 {
+		size = n
+	}
+	for i := 0; i < n; i += size {
+		r = append(r, [2]int{i, min(i+size, n)})
+	}
+	return
+}
+
+// insertMany 写入 reflectValue 中 [from,to) 之间的记录
+func insertMany(tx *DB, coll *mongo.Collection, from, to int) (err error) {
+	opts := options.InsertMany()
+	var documents []interface{}
+	for i := from; i < to; i++ {
+		documents = append(documents, tx.statement.reflectValue.Index(i).Interface())
+	}
+	var result *mongo.InsertManyResult
+	if result, err = coll.InsertMany(tx.statement.Context, documents, opts); err == nil {
+		tx.RowsAffected += int64(len(result.InsertedIDs))
+	}
+	return
+}
+
 // Update 通用更新
 // map ,BuildUpdate.m 支持 $set $incr $setOnInsert, 其他未使用$字段一律视为$set操作
 // 支持struct 保存所有非零值
 func cmdUpdate(tx *DB) (err error) {
 	stmt := tx.statement
 	var data update.Update
+	var filter clause.Filter
 	var upsert bool
-	if data, upsert, err = update.Build(stmt.value, stmt.schema, &stmt.selector); err != nil {
+	if data, filter, upsert, err = prepareUpdate(stmt); err != nil {
 		return
 	}
-	//fmt.Printf("update:%+v\n", update)
-	filter := stmt.Clause.Build(stmt.schema)
-	//filter := tx.statement.Clause.Build(tx.statement.schema)
-	if len(filter) == 0 {
-		return ErrMissingWhereClause
+	//乐观锁,匹配当前版本号并将版本号加1
+	version := versionField(stmt)
+	var versionValue int64
+	if version != nil {
+		versionValue = version.Get(stmt.reflectValue).Int()
+		filter[version.DBName] = versionValue
+		data.Remove(update.UpdateTypeSet, version.DBName)
+		data.Inc(version.DBName, 1)
 	}
 	//fmt.Printf("Update filter:%+v\n", filter)
-	coll := tx.client.Database(tx.dbname).Collection(stmt.table)
+	coll := stmt.collection()
 	//reflectModel := reflect.Indirect(reflect.ValueOf(tx.statement.model))
 	if stmt.multiple {
 		opts := options.Update()
+		if stmt.collation != nil {
+			opts.SetCollation(stmt.collation)
+		}
+		ctx, cancel := stmt.maxTimeContext()
+		defer cancel()
 		var result *mongo.UpdateResult
-		if result, err = coll.UpdateMany(stmt.Context, filter, data, opts); err == nil {
-			tx.RowsAffected = result.MatchedCount
+		if result, err = coll.UpdateMany(ctx, filter, data, opts); err == nil {
+			setUpdateResult(tx, result)
 		}
 	} else if stmt.updateAndModifyModel {
 		err = findOneAndUpdate(tx, coll, filter, data, upsert)
@@ -69,29 +111,123 @@ func cmdUpdate(tx *DB) (err error) {
 		tx.Error = err
 		return
 	}
+	if version != nil {
+		if tx.RowsAffected == 0 {
+			return ErrVersionConflict
+		}
+		if v := version.Get(stmt.reflectValue); v.CanSet() {
+			v.SetInt(versionValue + 1)
+		}
+	}
 	return
 }
 
+// prepareUpdate 生成更新内容和匹配条件,upsert 表示更新内容中包含 $setOnInsert
+func prepareUpdate(stmt *Statement) (data update.Update, filter clause.Filter, upsert bool, err error) {
+	if data, upsert, err = update.Build(stmt.value, stmt.schema, &stmt.selector); err != nil {
+		return
+	}
+	if stmt.merge {
+		if err = mergeSetOnInsert(stmt, data); err != nil {
+			return
+		}
+	}
+	for _, k := range stmt.unset {
+		k = stmt.DBName(k)
+		data.Remove(update.UpdateTypeSet, k)
+		data.Unset(k)
+	}
+	if v, ok := data[update.UpdateTypeSet]; ok && len(v) == 0 {
+		delete(data, update.UpdateTypeSet)
+	}
+	autoUpdateTime(stmt, data, upsert || stmt.upsert)
+	stmt.update = data
+	if filter = stmt.Clause.Build(stmt.schema); len(filter) == 0 {
+		err = ErrMissingWhereClause
+		return
+	}
+	//upsert 时不排除已删除文档,避免插入重复主键
+	if !upsert && !stmt.upsert {
+		stmt.scoped(filter)
+	}
+	return
+}
+
+// mergeSetOnInsert SaveOrMerge 时 SetOnInsert 返回的字段优先,从 $set 中移除,只在插入时写入
+func mergeSetOnInsert(stmt *Statement, data update.Update) error {
+	s, ok := stmt.value.(update.SetOnInsert)
+	if !ok {
+		return nil
+	}
+	values, err := s.SetOnInsert()
+	if err != nil {
+		return err
+	}
+	for k, v := range values {
+		k = stmt.DBName(k)
+		data.Remove(update.UpdateTypeSet, k)
+		data.SetOnInert(k, v)
+	}
+	return nil
+}
+
+// versionField 使用Struct更新单个文档时的乐观锁版本号字段
+func versionField(stmt *Statement) *schema.Field {
+	if stmt.multiple || stmt.reflectValue.Kind() != reflect.Struct || stmt.reflectValue.Type() != stmt.schema.ModelType {
+		return nil
+	}
+	field := LookUpTagField(stmt.schema, TagVersion)
+	if field == nil {
+		return nil
+	}
+	switch field.FieldType.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return field
+	}
+	return nil
+}
+
 func UpdateOne(tx *DB, coll *mongo.Collection, filter clause.Filter, data update.Update, upsert bool) (err error) {
 	opts := options.Update()
 	if upsert || tx.statement.upsert {
 		opts.SetUpsert(true)
 	}
+	if tx.statement.collation != nil {
+		opts.SetCollation(tx.statement.collation)
+	}
+	ctx, cancel := tx.statement.maxTimeContext()
+	defer cancel()
 	var result *mongo.UpdateResult
-	if result, err = coll.UpdateOne(tx.statement.Context, filter, data, opts); err == nil {
-		tx.RowsAffected = result.MatchedCount
+	if result, err = coll.UpdateOne(ctx, filter, data, opts); err == nil {
+		setUpdateResult(tx, result)
 	}
 
 	return
 }
 
+// setUpdateResult 匹配的文档数,upsert 插入新文档时为1并记录 LastInsertID
+func setUpdateResult(tx *DB, result *mongo.UpdateResult) {
+	if result.UpsertedID != nil {
+		tx.RowsAffected = result.UpsertedCount
+		tx.LastInsertID = result.UpsertedID
+	} else {
+		tx.RowsAffected = result.MatchedCount
+	}
+}
+
 func findOneAndUpdate(tx *DB, coll *mongo.Collection, filter clause.Filter, data update.Update, upsert bool) (err error) {
 	opts := options.FindOneAndUpdate()
 	if upsert || tx.statement.upsert {
 		opts.SetUpsert(true)
 	}
+	if tx.statement.collation != nil {
+		opts.SetCollation(tx.statement.collation)
+	}
+	if tx.statement.maxTime > 0 {
+		opts.SetMaxTime(tx.statement.maxTime)
+	}
 
-	if projection := tx.statement.selector.Projection(tx.statement.schema); len(projection) > 0 {
+	if projection := tx.statement.Projection(); len(projection) > 0 {
 		opts.SetProjection(projection)
 	}
 	opts.SetReturnDocument(options.After)
@@ -112,13 +248,62 @@ func findOneAndUpdate(tx *DB, coll *mongo.Collection, filter clause.Filter, data
 	return
 }
 
+// cmdUpsertReturn 查询或创建
+func cmdUpsertReturn(tx *DB) (err error) {
+	stmt := tx.statement
+	var data update.Update
+	if data, _, err = update.Build(stmt.value, stmt.schema, &stmt.selector); err != nil {
+		return
+	}
+	if values, ok := data[update.UpdateTypeSet]; ok {
+		for k, v := range values {
+			data.SetOnInert(k, v)
+		}
+		delete(data, update.UpdateTypeSet)
+	}
+	filter := stmt.Clause.Build(stmt.schema)
+	if len(filter) == 0 {
+		if field := stmt.schema.LookUpField(clause.MongoPrimaryName); field != nil && stmt.reflectValue.Kind() == reflect.Struct {
+			if v := field.Get(stmt.reflectValue); v.IsValid() && !v.IsZero() {
+				filter.Primary(v.Interface())
+			}
+		}
+	}
+	if len(filter) == 0 {
+		return ErrMissingWhereClause
+	}
+	if len(data) == 0 {
+		//update 不能为空,没有需要写入的字段时仅写入 _id
+		if clause.Multiple(filter) {
+			data.SetOnInert(clause.MongoPrimaryName, primitive.NewObjectID())
+		} else {
+			data.SetOnInert(clause.MongoPrimaryName, filter[clause.MongoPrimaryName])
+		}
+	}
+	opts := options.FindOneAndUpdate()
+	opts.SetUpsert(true)
+	opts.SetReturnDocument(options.After)
+	if projection := stmt.Projection(); len(projection) > 0 {
+		opts.SetProjection(projection)
+	}
+	coll := stmt.collection()
+	if err = coll.FindOneAndUpdate(stmt.Context, filter, data, opts).Decode(stmt.value); err == nil {
+		tx.RowsAffected = 1
+	}
+	return
+}
+
 // cmdDelete delete value match given conditions, if the value has primary key, then will including the primary key as condition
+// 启用软删除时只写入删除标记,使用 Unscoped 物理删除
 func cmdDelete(tx *DB) (err error) {
 	filter := tx.statement.Clause.Build(tx.statement.schema)
 	if len(filter) == 0 {
 		return ErrMissingWhereClause
 	}
-	coll := tx.client.Database(tx.dbname).Collection(tx.statement.table)
+	coll := tx.statement.collection()
+	if field := tx.statement.softDeleteField(); field != nil {
+		return softDelete(tx, coll, field, filter)
+	}
 	var result *mongo.DeleteResult
 	if clause.Multiple(filter) {
 		result, err = coll.DeleteMany(tx.statement.Context, filter)
@@ -131,10 +316,167 @@ func cmdDelete(tx *DB) (err error) {
 	return
 }
 
+// softDelete 写入软删除标记,已经删除的文档不会重复标记
+func softDelete(tx *DB, coll *mongo.Collection, field *schema.Field, filter clause.Filter) (err error) {
+	stmt := tx.statement
+	multiple := clause.Multiple(filter)
+	stmt.scoped(filter)
+	data := update.New()
+	v, _ := softDeleteValue(field, stmt.now())
+	data.Set(field.DBName, v)
+	var result *mongo.UpdateResult
+	if multiple {
+		result, err = coll.UpdateMany(stmt.Context, filter, data)
+	} else {
+		result, err = coll.UpdateOne(stmt.Context, filter, data)
+	}
+	if err == nil {
+		tx.RowsAffected = result.ModifiedCount
+	}
+	return
+}
+
+// cmdFindOneAndDelete 删除并返回被删除的文档
+func cmdFindOneAndDelete(tx *DB) (err error) {
+	stmt := tx.statement
+	filter := stmt.Clause.Build(stmt.schema)
+	if len(filter) == 0 {
+		return ErrMissingWhereClause
+	}
+	stmt.scoped(filter)
+	coll := stmt.collection()
+	opts := options.FindOneAndDelete()
+	if order := stmt.Order(); len(order) > 0 {
+		opts.SetSort(order)
+	}
+	if projection := stmt.Projection(); len(projection) > 0 {
+		opts.SetProjection(projection)
+	}
+	result := coll.FindOneAndDelete(stmt.Context, filter, opts)
+	if err = result.Err(); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			err = nil
+		}
+		return
+	}
+	if err = result.Decode(stmt.value); err == nil {
+		tx.RowsAffected = 1
+	}
+	return
+}
+
+// cmdFindOneAndReplace 替换并返回文档
+func cmdFindOneAndReplace(tx *DB) (err error) {
+	stmt := tx.statement
+	filter := stmt.Clause.Build(stmt.schema)
+	if len(filter) == 0 {
+		return ErrMissingWhereClause
+	}
+	if !stmt.upsert {
+		stmt.scoped(filter)
+	}
+	coll := stmt.collection()
+	opts := options.FindOneAndReplace()
+	opts.SetReturnDocument(stmt.returnDocument)
+	if stmt.upsert {
+		opts.SetUpsert(true)
+	}
+	if order := stmt.Order(); len(order) > 0 {
+		opts.SetSort(order)
+	}
+	if projection := stmt.Projection(); len(projection) > 0 {
+		opts.SetProjection(projection)
+	}
+	result := coll.FindOneAndReplace(stmt.Context, filter, stmt.value, opts)
+	if err = result.Err(); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			err = nil
+		}
+		return
+	}
+	tx.RowsAffected = 1
+	target := stmt.value
+	if reflect.ValueOf(target).Kind() != reflect.Ptr {
+		target = stmt.model
+	}
+	if target != nil {
+		err = result.Decode(target)
+	}
+	return
+}
+
+// cmdCount 统计匹配的文档数
+func cmdCount(tx *DB) (err error) {
+	stmt := tx.statement
+	coll := stmt.collection()
+	var val int64
+	if val, err = coll.CountDocuments(stmt.Context, stmt.Filter(), stmt.countOptions()); err == nil {
+		stmt.reflectValue.SetInt(val)
+	}
+	return
+}
+
+// cmdPage 分页查询,Paging.Record 为0时统计总记录数
+func cmdPage(tx *DB) (err error) {
+	stmt := tx.statement
+	paging := stmt.Paging
+	if err = pageUpdate(stmt); err != nil {
+		return
+	}
+	coll := stmt.collection()
+	filter := stmt.Filter()
+	if paging.Record == 0 {
+		var val int64
+		if val, err = coll.CountDocuments(stmt.Context, filter, stmt.countOptions()); err != nil {
+			return
+		}
+		paging.Result(int(val))
+	}
+	var cursor *mongo.Cursor
+	if cursor, err = coll.Find(stmt.Context, filter, stmt.findOptions()); err != nil {
+		return
+	}
+	if reflect.ValueOf(paging.Rows).Kind() == reflect.Ptr {
+		err = cursor.All(stmt.Context, paging.Rows)
+	} else {
+		err = cursor.All(stmt.Context, &paging.Rows)
+	}
+	if err == nil {
+		tx.RowsAffected = int64(reflect.Indirect(reflect.ValueOf(paging.Rows)).Len())
+	}
+	return
+}
+
+// pageUpdate Paging.Update 大于0时只查询之后更新的文档,优先按照更新时间倒序
+func pageUpdate(stmt *Statement) error {
+	if stmt.Paging.Update <= 0 || stmt.schema == nil {
+		return nil
+	}
+	f := stmt.schema.LookUpField(DBNameUpdate)
+	if f == nil {
+		return nil
+	}
+	stmt.updateOrder = f.DBName
+	stmt.Clause.Where(fmt.Sprintf("%v > ?", f.DBName), stmt.Paging.Update)
+	return stmt.Clause.Err()
+}
+
+// cmdRange 打开游标并保存在 stmt.value 中,由 Range 遍历并关闭
+func cmdRange(tx *DB) (err error) {
+	stmt := tx.statement
+	coll := stmt.collection()
+	var cursor *mongo.Cursor
+	if cursor, err = coll.Find(stmt.Context, stmt.Filter(), stmt.findOptions()); err != nil {
+		return
+	}
+	stmt.value = cursor
+	return
+}
+
 // cmdQuery find records that match given conditions
 // value must be a pointer to a slice
 func cmdQuery(tx *DB) (err error) {
-	filter := tx.statement.Clause.Build(tx.statement.schema)
+	filter := tx.statement.Filter()
 	//b, _ := json.Marshal(filter)
 	//fmt.Printf("Query Filter:%+v\n", string(b))
 	var multiple bool
@@ -144,20 +486,9 @@ func cmdQuery(tx *DB) (err error) {
 	default:
 		multiple = false
 	}
-	order := tx.statement.Order()
-
-	coll := tx.client.Database(tx.dbname).Collection(tx.statement.table)
+	coll := tx.statement.collection()
 	if !multiple {
-		opts := options.FindOne()
-		if offset := tx.statement.Paging.Offset(); offset > 0 {
-			opts.SetSkip(int64(offset))
-		}
-		if len(order) > 0 {
-			opts.SetSort(order)
-		}
-		if projection := tx.statement.selector.Projection(tx.statement.schema); len(projection) > 0 {
-			opts.SetProjection(projection)
-		}
+		opts := tx.statement.findOneOptions()
 		result := coll.FindOne(tx.statement.Context, filter, opts)
 		if err = result.Err(); err != nil {
 			if errors.Is(err, mongo.ErrNoDocuments) {
@@ -175,19 +506,7 @@ func cmdQuery(tx *DB) (err error) {
 			tx.RowsAffected = 1
 		}
 	} else {
-		opts := options.Find()
-		if tx.statement.Paging.Size > 0 {
-			opts.SetLimit(int64(tx.statement.Paging.Size))
-		}
-		if offset := tx.statement.Paging.Offset(); offset > 0 {
-			opts.SetSkip(int64(offset))
-		}
-		if len(order) > 0 {
-			opts.SetSort(order)
-		}
-		if projection := tx.statement.selector.Projection(tx.statement.schema); len(projection) > 0 {
-			opts.SetProjection(projection)
-		}
+		opts := tx.statement.findOptions()
 		var cursor *mongo.Cursor
 		if cursor, err = coll.Find(tx.statement.Context, filter, opts); err != nil {
 			return
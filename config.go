@@ -1,28 +1,29 @@
 package cosmo
 
 import (
+	"sync/atomic"
+	"time"
+
+	"github.com/hwcer/cosgo/logger"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
 // Config GORM config
 type Config struct {
-	models    []any
-	dbname    string
-	client    *mongo.Client
-	callbacks *callbacks
+	FieldAlias map[string]string //查询字段别名 alias => struct field,用于对外API字段名和存储字段名解耦
+	Client     *ClientConfig     //使用连接字符串 Start 时的客户端配置
+	models     []any
+	dbname     string
+	client     *atomic.Pointer[mongo.Client] //所有 Session 共享,Close 之后全部返回 ErrClientClosed
+	Plugins    map[string]Plugin             //使用 db.Use 注册的插件
+	callbacks  *Callbacks
+	skipHooks  bool
+	dryRun     bool
+	nowTime    func() time.Time
+	logger     logger.Interface
+	slowTime   time.Duration
 }
 
-//func (c *Config) AfterInitialize(db *DB) error {
-//	if db != nil {
-//		for _, plugin := range c.Plugins {
-//			if err := plugin.Initialize(db); err != nil {
-//				return err
-//			}
-//		}
-//	}
-//	return nil
-//}
-
 // Register 预注册的MODEL在启动时会自动创建索引
 func (c *Config) Register(model interface{}) {
 	c.models = append(c.models, model)
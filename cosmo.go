@@ -4,9 +4,14 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"reflect"
+	"sync/atomic"
 
+	"github.com/hwcer/cosmo/clause"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // DB GORM DB definition
@@ -16,6 +21,7 @@ type DB struct {
 	statement    *Statement
 	Error        error
 	RowsAffected int64 //操作影响的条数
+	LastInsertID any   //Create 单个文档或者 upsert 插入新文档时的 _id
 }
 
 // New
@@ -28,37 +34,46 @@ func New(configs ...*Config) (db *DB) {
 		config = &Config{}
 	}
 
-	//if config.Plugins == nil {
-	//	config.Plugins = map[string]Plugin{}
-	//}
+	if config.Plugins == nil {
+		config.Plugins = map[string]Plugin{}
+	}
+	if config.client == nil {
+		config.client = &atomic.Pointer[mongo.Client]{}
+	}
 	db = &DB{Config: config}
 	db.callbacks = initializeCallbacks()
 	db.statement = NewStatement(db)
 	return
 }
 
-func (db *DB) Start(dbname string, address interface{}) (err error) {
+// Start 连接数据库
+// address 为连接字符串时可以使用opts设置客户端选项,例如使用自定义编码 options.Client().SetRegistry(registry)
+func (db *DB) Start(dbname string, address interface{}, opts ...*options.ClientOptions) (err error) {
 	db.dbname = dbname
+	var client *mongo.Client
 	switch address.(type) {
 	case string:
-		db.Config.client, err = NewClient(address.(string))
+		client, err = NewClientWithConfig(address.(string), db.Config.Client, opts...)
 	case *mongo.Client:
-		db.Config.client = address.(*mongo.Client)
+		client = address.(*mongo.Client)
 	default:
 		err = errors.New("address error")
 	}
 	if err != nil {
 		return
 	}
+	db.client.Store(client)
 	if err = db.AutoMigrator(db.models...); err != nil {
 		return
 	}
 	return
 }
 
+// Close 断开数据库连接,重复调用或者未 Start 时直接返回
+// 关闭后的操作返回 ErrClientClosed,可以和其他操作并发调用
 func (db *DB) Close() (err error) {
-	if db.client != nil {
-		err = db.client.Disconnect(context.Background())
+	if client := db.client.Swap(nil); client != nil {
+		err = client.Disconnect(context.Background())
 	}
 	return
 }
@@ -84,13 +99,65 @@ func (db *DB) Session(session *Session) *DB {
 		tx.statement.Context = session.Context
 	}
 
-	//if session.Logger != nil {
-	//	tx.Config.Logger = config.Logger
-	//}
+	if session.SkipHooks {
+		tx.Config.skipHooks = true
+	}
+
+	if session.DryRun {
+		tx.Config.dryRun = true
+	}
+
+	if session.NowTime != nil {
+		tx.Config.nowTime = session.NowTime
+	}
+
+	if session.Logger != nil {
+		tx.Config.logger = session.Logger
+		tx.Config.slowTime = session.SlowThreshold
+	}
 
 	return tx
 }
 
+// Clone 复制当前的链式调用,包括查询条件,Model,Select,Omit,排序和分页
+// 用于在同一个基础查询上执行多个操作,复制体和原对象互不影响
+//
+//	base := db.Model(&User{}).Where("lv > ?", 10)
+//	base.Clone().Count(&total)
+//	base.Clone().Order("lv", -1).Find(&users)
+func (db *DB) Clone() *DB {
+	tx := &DB{Config: db.Config, clone: true, Error: db.Error}
+	src := db.statement
+	stmt := *src
+	stmt.DB = tx
+	stmt.Clause = src.Clause.Clone()
+	stmt.selector = src.selector.Clone()
+	paging := *src.Paging
+	paging.order = append([]bson.E(nil), src.Paging.order...)
+	stmt.Paging = &paging
+	stmt.orders = append([]bson.E(nil), src.orders...)
+	stmt.unset = append([]string(nil), src.unset...)
+	if src.elemMatch != nil {
+		stmt.elemMatch = make(map[string]clause.Filter, len(src.elemMatch))
+		for k, v := range src.elemMatch {
+			stmt.elemMatch[k] = v
+		}
+	}
+	//执行结果不复制
+	stmt.value = nil
+	stmt.reflectValue = reflect.Value{}
+	stmt.update = nil
+	stmt.dryRunResult = nil
+	tx.statement = &stmt
+	return tx
+}
+
+// GetClient 底层的 mongo.Client,用于 GridFS,管理命令等 cosmo 没有封装的功能
+// 未连接时返回nil
+func (db *DB) GetClient() *mongo.Client {
+	return db.client.Load()
+}
+
 // Database 新数据库
 func (db *DB) Database(dbname string) *DB {
 	return db.Session(&Session{DBName: dbname})
@@ -103,9 +170,12 @@ func (db *DB) Collection(model any) (tx *DB, coll *mongo.Collection) {
 		tx = db.Model(model)
 	}
 	tx = tx.callbacks.Call(tx, func(tx *DB) error {
-		coll = tx.client.Database(tx.dbname).Collection(tx.statement.table)
+		coll = tx.statement.collection()
 		return nil
 	})
+	if tx.Error == nil && coll == nil {
+		tx.Errorf(ErrDryRun)
+	}
 	return
 }
 
@@ -127,11 +197,31 @@ func (db *DB) WithContext(ctx context.Context) *DB {
 	return db.Session(&Session{Context: ctx})
 }
 
+// Transaction 在事务中执行fn,fn中必须使用参数tx进行数据库操作
+// fn 返回错误时自动回滚,遇到临时性事务错误时自动重试,事务需要副本集或分片集群
+func (db *DB) Transaction(fn func(tx *DB) error) (err error) {
+	client := db.GetClient()
+	if client == nil {
+		return ErrInvalidDB
+	}
+	var session mongo.Session
+	if session, err = client.StartSession(); err != nil {
+		return
+	}
+	defer session.EndSession(context.Background())
+	_, err = session.WithTransaction(db.statement.Context, func(sc mongo.SessionContext) (any, error) {
+		return nil, fn(db.WithContext(sc))
+	})
+	return
+}
+
 // Errorf add error to db
 func (db *DB) Errorf(format interface{}, args ...interface{}) *DB {
 	switch v := format.(type) {
 	case string:
 		db.Error = fmt.Errorf(v, args...)
+	case error:
+		db.Error = v
 	default:
 		db.Error = fmt.Errorf("%v", format)
 	}
@@ -144,20 +234,27 @@ func (db *DB) getInstance() *DB {
 	}
 	tx := &DB{Config: db.Config, clone: true}
 	tx.statement = NewStatement(tx)
+	tx.statement.Context = db.statement.Context
 	return tx
 }
 
-//func (db *DB) Use(plugin Plugin) error {
-//	name := plugin.Name()
-//	if _, ok := db.Plugins[name]; ok {
-//		return ErrRegistered
-//	}
-//	if err := plugin.Initialize(db); err != nil {
-//		return err
-//	}
-//	db.Plugins[name] = plugin
-//	return nil
-//}
+// Use 注册插件,同名插件只能注册一次
+func (db *DB) Use(plugin Plugin) error {
+	name := plugin.Name()
+	if _, ok := db.Plugins[name]; ok {
+		return ErrRegistered
+	}
+	if err := plugin.Initialize(db); err != nil {
+		return err
+	}
+	db.Plugins[name] = plugin
+	return nil
+}
+
+// Callback 操作处理器,用于插件注册 AroundHandle 或替换操作
+func (db *DB) Callback() *Callbacks {
+	return db.callbacks
+}
 
 func (db *DB) ObjectID() primitive.ObjectID {
 	return primitive.NewObjectID()
@@ -1,12 +1,39 @@
 package cosmo
 
 import (
+	"context"
+	"errors"
+	"github.com/hwcer/cosmo/clause"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"reflect"
 	"strconv"
+	"sync"
 	"testing"
 	"time"
 )
 
+const testAddress = "127.0.0.1:27017"
+
+var testDB struct {
+	once sync.Once
+	db   *DB
+	err  error
+}
+
+// newTestDB 连接测试数据库,无法连接时跳过测试
+func newTestDB(t *testing.T) *DB {
+	testDB.once.Do(func() {
+		testDB.db = New()
+		testDB.err = testDB.db.Start("cosmo_test", testAddress)
+	})
+	if testDB.err != nil {
+		t.Skipf("mongodb not available:%v", testDB.err)
+	}
+	return testDB.db
+}
+
 type Role struct {
 	Id   string `bson:"_id"`
 	Name string `bson:"name"`
@@ -79,3 +106,138 @@ func TestCosmo(t *testing.T) {
 		t.Logf("delete:%v", tx.RowsAffected)
 	}
 }
+
+func TestWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	tx := New().WithContext(ctx).Model(&Role{})
+	if tx.statement.Context != ctx {
+		t.Fatalf("context lost in chain")
+	}
+}
+
+func TestTransaction(t *testing.T) {
+	db := newTestDB(t)
+	ids := []string{"tx_1", "tx_2"}
+	db.Model(&Role{}).Delete(ids)
+	err := db.Transaction(func(tx *DB) error {
+		for _, id := range ids {
+			if r := tx.Create(&Role{Id: id, Name: id}); r.Error != nil {
+				return r.Error
+			}
+		}
+		return errors.New("rollback")
+	})
+	if err == nil || err.Error() != "rollback" {
+		t.Skipf("transaction not supported:%v", err)
+	}
+	var count int
+	if tx := db.Model(&Role{}).Count(&count, ids); tx.Error != nil {
+		t.Fatal(tx.Error)
+	} else if count != 0 {
+		t.Fatalf("transaction not rollback,count:%v", count)
+	}
+}
+
+// newOfflineDB 使用未连接的客户端启动,用于不访问数据库的测试
+func newOfflineDB(t *testing.T) *DB {
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI("mongodb://"+testAddress))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := New()
+	if err = db.Start("cosmo_test", client); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+	return db
+}
+
+func TestGetClient(t *testing.T) {
+	if New().GetClient() != nil {
+		t.Fatalf("GetClient should be nil before Start")
+	}
+	db := newOfflineDB(t)
+	client := db.GetClient()
+	if client == nil {
+		t.Fatalf("GetClient should not be nil after Start")
+	}
+	if db.GetClient() != client || db.Model(&Role{}).GetClient() != client || db.Database("other").GetClient() != client {
+		t.Fatalf("GetClient error")
+	}
+}
+
+func TestClose(t *testing.T) {
+	if err := New().Close(); err != nil {
+		t.Fatalf("Close before Start error:%v", err)
+	}
+	db := newOfflineDB(t)
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close twice error:%v", err)
+	}
+	var rows []*Role
+	if tx := db.Find(&rows); !errors.Is(tx.Error, ErrClientClosed) {
+		t.Fatalf("Find after Close error:%v", tx.Error)
+	}
+	if tx := New().Create(&Role{Id: "1"}); !errors.Is(tx.Error, ErrClientClosed) {
+		t.Fatalf("Create before Start error:%v", tx.Error)
+	}
+}
+
+func TestCloseConcurrent(t *testing.T) {
+	db := newOfflineDB(t)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_ = db.Close()
+		}()
+		go func() {
+			defer wg.Done()
+			_ = db.Database("other").GetClient()
+		}()
+	}
+	wg.Wait()
+	if db.GetClient() != nil || db.Database("other").GetClient() != nil {
+		t.Fatalf("GetClient after Close should be nil")
+	}
+}
+
+func TestClone(t *testing.T) {
+	base := New().Model(&testItem{}).Where("status = ?", "active").Select("Name").Order("Lv", -1).Limit(2)
+	branch := base.Clone().Where("lv > ?", 1).Order("_id", 1).Omit("Lv")
+	if branch.Error != ErrOmitOnSelectsExist {
+		t.Fatalf("Clone should copy selector:%v", branch.Error)
+	}
+	branch = base.Clone().Where("lv > ?", 1).Order("_id", 1).Select("Lv")
+	if filter := base.statement.Clause.Build(nil); !reflect.DeepEqual(filter, clause.Filter{"status": "active"}) {
+		t.Fatalf("Clone changed base filter:%v", filter)
+	}
+	if filter := branch.statement.Clause.Build(nil); !reflect.DeepEqual(filter, clause.Filter{"status": "active", "lv": bson.M{"$gt": 1}}) {
+		t.Fatalf("Clone filter error:%v", filter)
+	}
+	if len(base.statement.orders) != 1 || len(branch.statement.orders) != 2 || branch.statement.Paging.Size != 2 {
+		t.Fatalf("Clone order or paging error")
+	}
+	if base.statement.selector.Has("Lv") || !branch.statement.selector.Has("Lv") {
+		t.Fatalf("Clone selector should be independent")
+	}
+
+	db := newTestDB(t)
+	resetItems(t, db, testItems()...)
+	base = db.Model(&testItem{}).Where("status = ?", "active")
+	var total int64
+	if tx := base.Clone().Count(&total); tx.Error != nil || total != 2 {
+		t.Fatalf("Clone count error:%v,%v", tx.Error, total)
+	}
+	var rows []*testItem
+	if tx := base.Clone().Order("_id", -1).Find(&rows); tx.Error != nil || len(rows) != int(total) || rows[0].Id != 2 {
+		t.Fatalf("Clone find error:%v,%v", tx.Error, len(rows))
+	}
+}
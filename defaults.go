@@ -0,0 +1,118 @@
+package cosmo
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+
+	"github.com/hwcer/cosgo/schema"
+)
+
+// defaultField 设置了 default 标签的字段
+type defaultField struct {
+	field *schema.Field
+	value reflect.Value
+}
+
+// defaultFields 解析模型中的 default 标签,默认值按字段类型转换
+func defaultFields(sch *schema.Schema) (fields []defaultField, err error) {
+	if sch == nil {
+		return
+	}
+	sch.Range(func(field *schema.Field) bool {
+		s, ok := TagSettings(field)[TagDefault]
+		if !ok {
+			return true
+		}
+		var v reflect.Value
+		if v, err = defaultValue(field.IndirectFieldType, s); err != nil {
+			err = fmt.Errorf("field %v default value %q: %w", field.Name, s, err)
+			return false
+		}
+		fields = append(fields, defaultField{field: field, value: v})
+		return true
+	})
+	return
+}
+
+// defaultValue 将标签中的字符串转换成字段类型,支持字符串,布尔和数字
+func defaultValue(t reflect.Type, s string) (v reflect.Value, err error) {
+	v = reflect.New(t).Elem()
+	switch t.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		var b bool
+		if b, err = strconv.ParseBool(s); err == nil {
+			v.SetBool(b)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var i int64
+		if i, err = strconv.ParseInt(s, 10, t.Bits()); err == nil {
+			v.SetInt(i)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var i uint64
+		if i, err = strconv.ParseUint(s, 10, t.Bits()); err == nil {
+			v.SetUint(i)
+		}
+	case reflect.Float32, reflect.Float64:
+		var f float64
+		if f, err = strconv.ParseFloat(s, t.Bits()); err == nil {
+			v.SetFloat(f)
+		}
+	default:
+		err = ErrInvalidField
+	}
+	return
+}
+
+// setDefault 字段为零值时写入默认值,指针字段为nil时创建
+func setDefault(f defaultField, rv reflect.Value) {
+	v := f.field.Get(rv)
+	if !v.IsValid() || !v.CanSet() || !v.IsZero() {
+		return
+	}
+	if v.Kind() == reflect.Ptr {
+		v.Set(reflect.New(v.Type().Elem()))
+		v = v.Elem()
+	}
+	v.Set(f.value)
+}
+
+// createDefaults 创建文档时为零值字段写入 default 标签设置的默认值
+// 值类型无法区分未设置和明确设置的零值,零值总是被默认值替换;需要保存零值时使用指针字段
+func createDefaults(stmt *Statement) error {
+	fields, err := defaultFields(stmt.schema)
+	if err != nil || len(fields) == 0 {
+		return err
+	}
+	setStruct := func(rv reflect.Value) {
+		rv = reflect.Indirect(rv)
+		if rv.Kind() != reflect.Struct || rv.Type() != stmt.schema.ModelType {
+			return
+		}
+		for _, f := range fields {
+			setDefault(f, rv)
+		}
+	}
+	rv := stmt.reflectValue
+	switch rv.Kind() {
+	case reflect.Struct:
+		setStruct(rv)
+	case reflect.Array, reflect.Slice:
+		for i := 0; i < rv.Len(); i++ {
+			setStruct(rv.Index(i))
+		}
+	case reflect.Map:
+		if rv.IsNil() || rv.Type().Key().Kind() != reflect.String || rv.Type().Elem().Kind() != reflect.Interface {
+			return nil
+		}
+		for _, f := range fields {
+			if k := reflect.ValueOf(f.field.DBName); !rv.MapIndex(k).IsValid() {
+				rv.SetMapIndex(k, f.value)
+			}
+		}
+	}
+	return nil
+}
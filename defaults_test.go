@@ -0,0 +1,83 @@
+package cosmo
+
+import (
+	"testing"
+)
+
+type testDefault struct {
+	Id     int     `bson:"_id"`
+	Status string  `bson:"status" cosmo:"default:active"`
+	Level  int     `bson:"level" cosmo:"default:1"`
+	Rate   float64 `bson:"rate" cosmo:"default:0.5"`
+	Vip    *bool   `bson:"vip" cosmo:"default:true"`
+}
+
+type testDefaultInvalid struct {
+	Id    int `bson:"_id"`
+	Level int `bson:"level" cosmo:"default:abc"`
+}
+
+// testCreateDefaults 模拟 cmdCreate 写入默认值
+func testCreateDefaults(t *testing.T, model, value any) error {
+	tx := New().Model(model)
+	tx.statement.value = value
+	if tx = tx.statement.Parse(); tx.Error != nil {
+		t.Fatal(tx.Error)
+	}
+	return createDefaults(tx.statement)
+}
+
+func TestCreateDefaults(t *testing.T) {
+	role := &testDefault{Id: 1}
+	if err := testCreateDefaults(t, role, role); err != nil {
+		t.Fatal(err)
+	}
+	if role.Status != "active" || role.Level != 1 || role.Rate != 0.5 || role.Vip == nil || !*role.Vip {
+		t.Fatalf("single create defaults error:%+v", role)
+	}
+
+	vip := false
+	rows := []*testDefault{{Id: 1}, {Id: 2, Status: "closed", Level: 9, Vip: &vip}}
+	if err := testCreateDefaults(t, &testDefault{}, &rows); err != nil {
+		t.Fatal(err)
+	}
+	if rows[0].Status != "active" || rows[0].Level != 1 {
+		t.Fatalf("slice create defaults error:%+v", rows[0])
+	}
+	if rows[1].Status != "closed" || rows[1].Level != 9 || *rows[1].Vip {
+		t.Fatalf("defaults overwrite explicit value:%+v", rows[1])
+	}
+
+	doc := map[string]any{"_id": 3, "level": 5}
+	if err := testCreateDefaults(t, &testDefault{}, doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc["status"] != "active" || doc["level"] != 5 {
+		t.Fatalf("map create defaults error:%v", doc)
+	}
+
+	if err := testCreateDefaults(t, &testDefaultInvalid{}, &testDefaultInvalid{}); err == nil {
+		t.Fatalf("invalid default should return error")
+	}
+}
+
+func TestCreateDefaultsInsert(t *testing.T) {
+	db := newTestDB(t)
+	_, coll := db.Collection(&testDefault{})
+	_, _ = coll.DeleteMany(db.statement.Context, map[string]any{})
+	if tx := db.Create(&testDefault{Id: 1}); tx.Error != nil {
+		t.Fatal(tx.Error)
+	}
+	if tx := db.Create([]*testDefault{{Id: 2}, {Id: 3, Level: 3}}); tx.Error != nil {
+		t.Fatal(tx.Error)
+	}
+	var rows []*testDefault
+	if tx := db.Order("_id", 1).Find(&rows); tx.Error != nil || len(rows) != 3 {
+		t.Fatalf("find error:%v,%v", tx.Error, len(rows))
+	}
+	for i, level := range []int{1, 1, 3} {
+		if rows[i].Status != "active" || rows[i].Level != level {
+			t.Fatalf("inserted defaults error:%+v", rows[i])
+		}
+	}
+}
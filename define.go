@@ -2,10 +2,14 @@ package cosmo
 
 const DBNameUpdate = "update"
 
-// Plugin GORM plugin interface
-//type Plugin interface {
-//	Name() string
-//	Initialize(*DB) error
-//}
+// Plugin 插件,使用 db.Use 注册,在 Initialize 中通过 db.Callback() 注册处理器
+type Plugin interface {
+	Name() string
+	Initialize(*DB) error
+}
 
 type executeHandle func(db *DB) error
+
+// AroundHandle 包裹 create,query,update,delete 操作的处理器,调用 next 执行模型钩子和操作
+// 不调用 next 时操作不会执行,返回的错误写入 tx.Error
+type AroundHandle func(tx *DB, next func() error) error
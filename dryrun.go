@@ -0,0 +1,47 @@
+package cosmo
+
+import (
+	"github.com/hwcer/cosmo/clause"
+	"github.com/hwcer/cosmo/update"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// DryRunResult DryRun 模式下生成的操作内容,没有发送到数据库
+type DryRunResult struct {
+	Table      string
+	Filter     clause.Filter
+	Update     update.Update //Update 时的更新内容
+	Sort       bson.D
+	Projection bson.M
+	Value      any //Create 时写入的文档
+}
+
+// DryRunResult DryRun 模式下最后一次操作生成的内容,非 DryRun 模式时为nil
+func (db *DB) DryRunResult() *DryRunResult {
+	return db.statement.dryRunResult
+}
+
+// dryRun 生成操作内容但不执行,不调用模型钩子和插件
+func (p *processor) dryRun(tx *DB) (err error) {
+	stmt := tx.statement
+	r := &DryRunResult{Table: stmt.table, Sort: stmt.Order(), Projection: stmt.Projection()}
+	switch p.name {
+	case CallbackCreate:
+		//和 cmdCreate 一致,记录写入默认值和创建时间之后的文档
+		if err = createDefaults(stmt); err != nil {
+			return
+		}
+		autoCreateTime(stmt)
+		r.Value = stmt.value
+	case CallbackUpdate:
+		if r.Update, r.Filter, _, err = prepareUpdate(stmt); err != nil {
+			return
+		}
+	case CallbackDelete:
+		r.Filter = stmt.Clause.Build(stmt.schema)
+	default:
+		r.Filter = stmt.Filter()
+	}
+	stmt.dryRunResult = r
+	return
+}
@@ -0,0 +1,82 @@
+package cosmo
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hwcer/cosmo/clause"
+	"github.com/hwcer/cosmo/update"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestDryRun(t *testing.T) {
+	db := New().Session(&Session{DryRun: true})
+	up := update.New()
+	up.Set("Name", "x")
+	up.Inc("Lv", 1)
+	tx := db.Model(&testItem{}).Where("lv > ?", 1).Update(up)
+	if tx.Error != nil {
+		t.Fatal(tx.Error)
+	}
+	r := tx.DryRunResult()
+	if r == nil || r.Table == "" {
+		t.Fatalf("DryRunResult error:%+v", r)
+	}
+	wantUpdate := update.Update{update.UpdateTypeSet: {"name": "x"}, update.UpdateTypeInc: {"lv": 1}}
+	if !reflect.DeepEqual(r.Update, wantUpdate) {
+		t.Fatalf("dry run update = %v, want %v", r.Update, wantUpdate)
+	}
+	if !reflect.DeepEqual(r.Filter, clause.Filter{"lv": bson.M{"$gt": 1}}) {
+		t.Fatalf("dry run filter error:%v", r.Filter)
+	}
+	//缺少条件时仍然返回错误
+	if tx = db.Model(&testItem{}).Update(bson.M{"Name": "x"}); tx.Error != ErrMissingWhereClause {
+		t.Fatalf("dry run missing where error:%v", tx.Error)
+	}
+	//查询不修改结果
+	var rows []*testItem
+	tx = db.Model(&testItem{}).Order("Lv", -1).Select("Name").Find(&rows, "status = ?", "active")
+	if tx.Error != nil || len(rows) != 0 {
+		t.Fatalf("dry run find error:%v", tx.Error)
+	}
+	r = tx.DryRunResult()
+	if !reflect.DeepEqual(r.Filter, clause.Filter{"status": "active"}) || !reflect.DeepEqual(r.Sort, bson.D{{Key: "lv", Value: -1}}) || !reflect.DeepEqual(r.Projection, bson.M{"name": true}) {
+		t.Fatalf("dry run find result error:%+v", r)
+	}
+	//Range,Stream 不执行
+	if tx = db.Model(&testItem{}).Range(func(Cursor) bool { return true }); tx.Error != nil || tx.RowsAffected != 0 {
+		t.Fatalf("dry run range error:%v", tx.Error)
+	}
+	rowsCh, errs := db.Model(&testItem{}).Stream(context.Background(), 0)
+	for range rowsCh {
+		t.Fatalf("dry run stream should not return rows")
+	}
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+	if _, coll := db.Collection(&testItem{}); coll != nil {
+		t.Fatalf("dry run collection should be nil")
+	}
+	if New().Model(&testItem{}).DryRunResult() != nil {
+		t.Fatalf("DryRunResult should be nil without dry run")
+	}
+}
+
+func TestDryRunCreate(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	db := New().Session(&Session{DryRun: true, NowTime: func() time.Time { return now }})
+	v := &testAutoTime{Id: 1}
+	tx := db.Create(v)
+	if r := tx.DryRunResult(); tx.Error != nil || r.Value != v || v.Created != now.Unix() {
+		t.Fatalf("dry run create autoCreateTime error:%v,%+v", tx.Error, v)
+	}
+	d := &testDefault{Id: 1}
+	if tx = db.Create(d); tx.Error != nil || d.Status != "active" || d.Level != 1 {
+		t.Fatalf("dry run create defaults error:%v,%+v", tx.Error, d)
+	}
+	if tx = db.Create(&testDefaultInvalid{Id: 1}); tx.Error == nil {
+		t.Fatalf("dry run create invalid default should return error")
+	}
+}
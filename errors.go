@@ -41,4 +41,15 @@ var (
 	ErrSelectOnOmitsExist = errors.New("select on omits exist")
 
 	ErrOmitOnSelectsExist = errors.New("omit on selects exist")
+
+	// ErrClientClosed 未连接数据库或者已经 Close
+	ErrClientClosed = errors.New("client closed or not started")
+	// ErrVersionConflict 乐观锁版本号不一致,文档已经被其他人修改
+	ErrVersionConflict = errors.New("version conflict")
+	// ErrIndexDuplicate 集合中已有重复数据,无法创建唯一索引
+	ErrIndexDuplicate = errors.New("duplicate values prevent unique index")
+	// ErrDryRun DryRun 模式下无法获取集合
+	ErrDryRun = errors.New("collection not available in dry run mode")
+	// ErrInvalidPipeline 聚合管道中存在无效的阶段
+	ErrInvalidPipeline = errors.New("invalid pipeline stage")
 )
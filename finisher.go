@@ -1,12 +1,16 @@
 package cosmo
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"github.com/hwcer/cosmo/clause"
 	"github.com/hwcer/cosmo/update"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"reflect"
+	"strings"
 )
 
 const DefaultPageSize = 100
@@ -22,84 +26,122 @@ func (db *DB) Inc(key string, val int) (tx *DB) {
 	return db.Update(up)
 }
 
-// Page 分页查询
+// IncMany 使用一个 $inc 同时增加多个字段,值为负数时减少
+// 需要同时 $set 其他字段时直接使用 update.Update
+//
+//	db.Model(&User{}).Where(1).IncMany(map[string]int{"Lv": 1, "Exp": 100})
+func (db *DB) IncMany(values map[string]int) (tx *DB) {
+	up := update.Update{}
+	for k, v := range values {
+		up.Inc(k, v)
+	}
+	return db.Update(up)
+}
+
+// Counter 计数器,将id对应文档的field字段增加delta,文档不存在时自动创建,返回增加后的值
+//
+//	db.Model(&Sequence{}).Counter("user", "Value", 1)
+func (db *DB) Counter(id any, field string, delta int) (newValue int64, err error) {
+	tx := db.getInstance()
+	tx.statement.Clause.Primary(id)
+	tx = tx.callbacks.Call(tx, func(tx *DB) error {
+		stmt := tx.statement
+		k := stmt.DBName(field)
+		up := update.Update{}
+		up.Inc(k, delta)
+		opts := options.FindOneAndUpdate()
+		opts.SetUpsert(true)
+		opts.SetReturnDocument(options.After)
+		opts.SetProjection(bson.M{k: 1})
+		coll := stmt.collection()
+		values := bson.M{}
+		if err := coll.FindOneAndUpdate(stmt.Context, stmt.Clause.Build(stmt.schema), up, opts).Decode(&values); err != nil {
+			return err
+		}
+		switch v := values[k].(type) {
+		case int32:
+			newValue = int64(v)
+		case int64:
+			newValue = v
+		case float64:
+			newValue = int64(v)
+		default:
+			return fmt.Errorf("counter field %v type error:%T", k, v)
+		}
+		tx.RowsAffected = 1
+		return nil
+	})
+	return newValue, tx.Error
+}
+
+// UpsertReturn 查询或创建,文档存在时返回已有文档,不存在时使用val创建新文档并返回
+// val 中的非零值字段仅在创建时写入($setOnInsert),创建后数据库生成的 _id 会写入val
+//
+//	db.UpsertReturn(&User{Name: "hwc", Lv: 1}, "name = ?", "hwc")
+func (db *DB) UpsertReturn(val any, where ...any) (tx *DB) {
+	tx = db.getInstance()
+	if len(where) > 0 {
+		tx = tx.Where(where[0], where[1:]...)
+	}
+	tx.statement.value = val
+	return tx.callbacks.Call(tx, cmdUpsertReturn)
+}
+
+// Page 分页查询,Paging.Record 为0时统计总记录数并计算总页数
 func (db *DB) Page(paging *Paging, where ...any) (tx *DB) {
-	//var err error
-	db.statement.Paging = paging
 	paging.Init(DefaultPageSize)
 	if paging.Rows == nil {
 		paging.Rows = []bson.M{}
 	}
 	tx = db.getInstance()
-	stmt := tx.statement
-	reflectRows := reflect.ValueOf(paging.Rows)
-	indirectRows := reflect.Indirect(reflectRows)
+	if len(where) > 0 {
+		tx = tx.Where(where[0], where[1:]...)
+	}
+	indirectRows := reflect.Indirect(reflect.ValueOf(paging.Rows))
 	if indirectRows.Kind() != reflect.Array && indirectRows.Kind() != reflect.Slice {
 		_ = tx.Errorf("paging.Rows type not Array or Slice")
 		return
 	}
+	tx.statement.Paging = paging
+	tx.statement.value = paging.Rows
+	return tx.callbacks.Call(tx, cmdPage)
+}
+
+// Range 使用游标逐条遍历匹配的文档,handle 返回 false 时停止,必须使用 Model 指定模型
+// 使用 BatchSize 设置游标每批读取的文档数量
+// RowsAffected 为已经遍历的文档数量
+//
+//	db.Model(&User{}).Where("lv > ?", 10).Range(func(c Cursor) bool { c.Decode(&user); return true })
+func (db *DB) Range(handle func(Cursor) bool, where ...any) (tx *DB) {
+	tx = db.getInstance()
 	if len(where) > 0 {
 		tx = tx.Where(where[0], where[1:]...)
 	}
-	stmt.value = paging.Rows
-
-	if tx = tx.statement.Parse(); tx.Error != nil {
+	if tx.statement.model == nil {
+		_ = tx.Errorf(ErrModelValueRequired)
 		return
 	}
-
-	if stmt.table == "" {
-		_ = tx.Errorf("table not set, please set it like: db.model(&user) or db.table(\"users\") %+v")
+	if tx = tx.callbacks.Call(tx, cmdRange); tx.Error != nil {
 		return
 	}
-
-	if paging.Update > 0 {
-		if f := stmt.schema.LookUpField(DBNameUpdate); f != nil {
-			tx.Order(f.DBName, -1)
-			tx.Where(fmt.Sprintf("%v > ?", f.DBName), paging.Update)
-		}
+	stmt := tx.statement
+	cursor, ok := stmt.value.(*mongo.Cursor)
+	if !ok {
+		return //DryRun
 	}
-	//defer tx.reset()
-
-	coll := tx.client.Database(tx.dbname).Collection(stmt.table)
-	filter := tx.statement.Clause.Build(stmt.schema)
-
-	if paging.Record == 0 && tx.Error == nil {
-		var val int64
-		if val, tx.Error = coll.CountDocuments(stmt.Context, filter); tx.Error == nil {
-			paging.Result(int(val))
-		} else {
+	defer func() {
+		_ = cursor.Close(context.Background())
+	}()
+	for cursor.Next(stmt.Context) {
+		tx.RowsAffected++
+		if !handle(Cursor(cursor.Current)) {
 			return
 		}
 	}
-	//find
-	order := tx.statement.Order()
-	opts := options.Find()
-	if stmt.Paging.Size > 0 {
-		opts.SetLimit(int64(tx.statement.Paging.Size))
-	}
-	if offset := stmt.Paging.Offset(); offset > 0 {
-		opts.SetSkip(int64(offset))
-	}
-	if len(order) > 0 {
-		opts.SetSort(order)
-	}
-	if projection := tx.statement.selector.Projection(stmt.schema); len(projection) > 0 {
-		opts.SetProjection(projection)
-	}
-	var cursor *mongo.Cursor
-	if cursor, tx.Error = coll.Find(stmt.Context, filter, opts); tx.Error != nil {
-		return
-	}
-	//cursor.RemainingBatchLength()
-	if reflectRows.Kind() == reflect.Ptr {
-		tx.Error = cursor.All(stmt.Context, paging.Rows)
-	} else {
-		tx.Error = cursor.All(stmt.Context, &paging.Rows)
-	}
-	if tx.Error == nil {
-		tx.RowsAffected = int64(indirectRows.Len())
+	if err := cursor.Err(); err != nil {
+		_ = tx.Errorf(err)
 	}
-	return tx
+	return
 }
 
 // Find  get records that match given conditions
@@ -113,6 +155,53 @@ func (db *DB) Find(val any, where ...any) (tx *DB) {
 	return tx.callbacks.Query().Execute(tx)
 }
 
+// First 查询第一条记录,没有使用 Order 设置排序时按 _id 升序
+// val 必须为结构体指针
+func (db *DB) First(val any, where ...any) (tx *DB) {
+	return db.findOneOrder(val, 1, where...)
+}
+
+// Last 查询最后一条记录,没有使用 Order 设置排序时按 _id 降序
+// val 必须为结构体指针
+func (db *DB) Last(val any, where ...any) (tx *DB) {
+	return db.findOneOrder(val, -1, where...)
+}
+
+func (db *DB) findOneOrder(val any, sort int, where ...any) (tx *DB) {
+	tx = db.getInstance()
+	if len(where) > 0 {
+		tx = tx.Where(where[0], where[1:]...)
+	}
+	if len(tx.statement.orders) == 0 {
+		tx = tx.Order(clause.MongoPrimaryName, sort)
+	}
+	tx.statement.value = val
+	return tx.callbacks.Query().Execute(tx)
+}
+
+// Scan 使用 Model 确定集合和字段名称,将查询结果解码到 dest,dest 可以是与模型不同的结构体
+// dest 为指向Slice的指针时查询多条记录,为结构体指针时查询一条记录
+//
+//	var rows []struct {
+//		Id   int    `bson:"_id"`
+//		Name string `bson:"name"`
+//	}
+//	db.Model(&User{}).Select("Id", "Name").Scan(&rows, "lv > ?", 10)
+func (db *DB) Scan(dest any, where ...any) (tx *DB) {
+	tx = db.getInstance()
+	if len(where) > 0 {
+		tx = tx.Where(where[0], where[1:]...)
+	}
+	if tx.statement.model == nil {
+		return tx.Errorf(ErrModelValueRequired)
+	}
+	if reflect.ValueOf(dest).Kind() != reflect.Ptr {
+		return tx.Errorf("scan dest must be a pointer")
+	}
+	tx.statement.value = dest
+	return tx.callbacks.Query().Execute(tx)
+}
+
 // Create insert the value into dbname
 func (db *DB) Create(value interface{}) (tx *DB) {
 	tx = db.getInstance()
@@ -120,6 +209,18 @@ func (db *DB) Create(value interface{}) (tx *DB) {
 	return tx.callbacks.Create().Execute(tx)
 }
 
+// CreateInBatches 分批写入,value 必须为Slice,每批 batchSize 条,batchSize<=0 时使用 DefaultPageSize
+// 遇到错误时停止,RowsAffected 为已经写入的数量,错误信息中包含失败的批次
+func (db *DB) CreateInBatches(value interface{}, batchSize int) (tx *DB) {
+	tx = db.getInstance()
+	if batchSize <= 0 {
+		batchSize = DefaultPageSize
+	}
+	tx.statement.value = value
+	tx.statement.batchSize = batchSize
+	return tx.callbacks.Create().Execute(tx)
+}
+
 //Update 通用更新
 // values 类型为map ,bson.M 时支持 $set $inc $setOnInsert, 其他未使用$前缀字段一律视为$set操作
 // values 类型为struct保存所有非零值,如果需要将零值写入数据库，请使用map方式
@@ -137,6 +238,36 @@ func (db *DB) Update(values any, conds ...any) (tx *DB) {
 	return tx.callbacks.Update().Execute(tx)
 }
 
+// Updates 批量更新所有匹配的文档,values 使用 Struct 时可以使用 Select,Omit 选择写入的字段
+//
+//	db.Model(&User{}).Select("Name").Updates(&User{Name: "hwc", Lv: 2}, "lv > ?", 1)
+func (db *DB) Updates(values any, conds ...any) (tx *DB) {
+	tx = db.getInstance()
+	if len(conds) > 0 {
+		tx = tx.Where(conds[0], conds[1:]...)
+	}
+	tx.statement.multiple = true
+	tx.statement.updateAndModifyModel = false
+	tx.statement.value = values
+	return tx.callbacks.Update().Execute(tx)
+}
+
+// SaveOrMerge 使用Struct保存文档,文档不存在时插入新文档
+// val 实现 update.SetOnInsert 时,返回的字段(例如创建时间)只在插入时写入,即使 val 中的值不为零也不会修改已经存在的文档
+// 其他非零值字段每次都会更新
+//
+//	db.SaveOrMerge(&User{Id: 1, Name: "hwc"}, 1)
+func (db *DB) SaveOrMerge(val any, conds ...any) (tx *DB) {
+	tx = db.getInstance()
+	if len(conds) > 0 {
+		tx = tx.Where(conds[0], conds[1:]...)
+	}
+	tx.statement.upsert = true
+	tx.statement.merge = true
+	tx.statement.value = val
+	return tx.callbacks.Update().Execute(tx)
+}
+
 // Delete 删除记录
 // db.delete(&User{Id:1,name:"myname"})  匹配 _id=1
 // db.model(&User).delete(1) 匹配 _id=1
@@ -152,6 +283,7 @@ func (db *DB) Delete(conds ...interface{}) (tx *DB) {
 }
 
 // Count 统计文档数,count 必须为一个指向数字的指针  *int *int32 *int64
+// 与查询一样使用 Hint,Collation,MaxTime 等设置,Context 已经取消时不会执行
 func (db *DB) Count(count interface{}, conds ...interface{}) (tx *DB) {
 	tx = db.getInstance()
 	if len(conds) > 0 {
@@ -159,13 +291,456 @@ func (db *DB) Count(count interface{}, conds ...interface{}) (tx *DB) {
 	}
 
 	tx.statement.value = count
-	return tx.statement.callbacks.Call(tx, func(db *DB) (err error) {
+	return tx.callbacks.Call(tx, cmdCount)
+}
+
+// Exists 是否存在匹配的文档,必须使用 Model 指定模型
+// 只返回 _id 并且最多读取一条,比 Count 更快
+func (db *DB) Exists(where ...any) (exist bool, err error) {
+	tx := db.getInstance()
+	if len(where) > 0 {
+		tx = tx.Where(where[0], where[1:]...)
+	}
+	if tx.statement.model == nil {
+		return false, ErrModelValueRequired
+	}
+	tx = tx.callbacks.Call(tx, func(tx *DB) error {
+		stmt := tx.statement
+		opts := stmt.findOneOptions()
+		opts.SetProjection(bson.M{clause.MongoPrimaryName: 1})
+		coll := stmt.collection()
+		result := coll.FindOne(stmt.Context, stmt.Filter(), opts)
+		if e := result.Err(); e != nil {
+			if errors.Is(e, mongo.ErrNoDocuments) {
+				return nil
+			}
+			return e
+		}
+		exist = true
+		return nil
+	})
+	return exist, tx.Error
+}
+
+// Explain 返回查询计划,verbosity 支持 queryPlanner(默认),executionStats,allPlansExecution
+// 使用 Find 相同的查询条件,排序,分页和返回字段,必须使用 Model 指定模型,暂不支持 Update,Delete
+func (db *DB) Explain(verbosity string) (plan bson.M, err error) {
+	tx := db.getInstance()
+	if tx.statement.model == nil {
+		return nil, ErrModelValueRequired
+	}
+	switch verbosity {
+	case "":
+		verbosity = "queryPlanner"
+	case "queryPlanner", "executionStats", "allPlansExecution":
+	default:
+		return nil, fmt.Errorf("explain verbosity error:%v", verbosity)
+	}
+	tx = tx.callbacks.Call(tx, func(tx *DB) error {
+		cmd := bson.D{{Key: "explain", Value: explainFind(tx.statement)}, {Key: "verbosity", Value: verbosity}}
+		return tx.statement.client.Database(tx.dbname).RunCommand(tx.statement.Context, cmd).Decode(&plan)
+	})
+	return plan, tx.Error
+}
+
+// explainFind 和 Find 一致的 find 命令
+func explainFind(stmt *Statement) bson.D {
+	opts := stmt.findOptions()
+	cmd := bson.D{{Key: "find", Value: stmt.table}, {Key: "filter", Value: stmt.Filter()}}
+	if opts.Sort != nil {
+		cmd = append(cmd, bson.E{Key: "sort", Value: opts.Sort})
+	}
+	if opts.Projection != nil {
+		cmd = append(cmd, bson.E{Key: "projection", Value: opts.Projection})
+	}
+	if opts.Skip != nil {
+		cmd = append(cmd, bson.E{Key: "skip", Value: *opts.Skip})
+	}
+	if opts.Limit != nil {
+		cmd = append(cmd, bson.E{Key: "limit", Value: *opts.Limit})
+	}
+	if opts.Hint != nil {
+		cmd = append(cmd, bson.E{Key: "hint", Value: opts.Hint})
+	}
+	if opts.Collation != nil {
+		cmd = append(cmd, bson.E{Key: "collation", Value: opts.Collation.ToDocument()})
+	}
+	if opts.MaxTime != nil {
+		cmd = append(cmd, bson.E{Key: "maxTimeMS", Value: opts.MaxTime.Milliseconds()})
+	}
+	return cmd
+}
+
+// EstimatedCount 快速统计文档数,count 必须为一个指向数字的指针  *int *int32 *int64
+// 没有查询条件时使用集合元数据统计(EstimatedDocumentCount),速度快但在异常关闭或分片迁移时可能不准确
+// 存在查询条件时元数据无法过滤,自动使用 CountDocuments 精确统计
+func (db *DB) EstimatedCount(count interface{}, where ...any) (tx *DB) {
+	tx = db.getInstance()
+	if len(where) > 0 {
+		tx = tx.Where(where[0], where[1:]...)
+	}
+	tx.statement.value = count
+	return tx.callbacks.Call(tx, func(tx *DB) (err error) {
 		var val int64
-		coll := tx.client.Database(tx.dbname).Collection(tx.statement.table)
-		filter := tx.statement.Clause.Build(db.statement.schema)
-		if val, err = coll.CountDocuments(tx.statement.Context, filter); err == nil {
-			tx.statement.reflectValue.SetInt(val)
+		stmt := tx.statement
+		coll := stmt.collection()
+		if filter := stmt.Filter(); len(filter) == 0 {
+			val, err = coll.EstimatedDocumentCount(stmt.Context)
+		} else {
+			val, err = coll.CountDocuments(stmt.Context, filter, stmt.countOptions())
 		}
-		return err
+		if err == nil {
+			stmt.reflectValue.SetInt(val)
+		}
+		return
 	})
 }
+
+// Aggregate 聚合查询,result 必须为指向Slice的指针
+// pipeline 支持 Pipeline,[]bson.D,mongo.Pipeline,bson.A 等驱动支持的类型
+// Where 条件不会自动加入管道,需要在pipeline中使用 $match
+func (db *DB) Aggregate(pipeline any, result any) (tx *DB) {
+	tx = db.getInstance()
+	if p, ok := pipeline.(Pipeline); ok {
+		if err := p.Err(); err != nil {
+			return tx.Errorf(err)
+		}
+	}
+	tx.statement.value = result
+	return tx.callbacks.Call(tx, func(tx *DB) (err error) {
+		stmt := tx.statement
+		coll := stmt.collection()
+		opts := options.Aggregate()
+		if stmt.allowDiskUse {
+			opts.SetAllowDiskUse(true)
+		}
+		var cursor *mongo.Cursor
+		if cursor, err = coll.Aggregate(stmt.Context, pipeline, opts); err != nil {
+			return
+		}
+		if err = cursor.All(stmt.Context, result); err == nil {
+			tx.RowsAffected = int64(stmt.reflectValue.Len())
+		}
+		return
+	})
+}
+
+// Distinct 查询字段的所有不重复值,result 必须为指向Slice的指针 *[]string *[]int ...
+// 需要使用Model指定集合
+func (db *DB) Distinct(field string, result any, where ...any) (tx *DB) {
+	tx = db.getInstance()
+	if len(where) > 0 {
+		tx = tx.Where(where[0], where[1:]...)
+	}
+	if tx.statement.model == nil {
+		return tx.Errorf(ErrModelValueRequired)
+	}
+	reflectValue := reflect.ValueOf(result)
+	if reflectValue.Kind() != reflect.Ptr || reflectValue.Elem().Kind() != reflect.Slice {
+		return tx.Errorf("distinct result must be a pointer to slice")
+	}
+	return tx.callbacks.Call(tx, func(tx *DB) (err error) {
+		stmt := tx.statement
+		coll := stmt.collection()
+		filter := stmt.Filter()
+		var values []any
+		if values, err = coll.Distinct(stmt.Context, stmt.DBName(field), filter); err != nil {
+			return
+		}
+		//通过bson解码,兼容 int32 => int 等数据库类型到Go类型的转换
+		var raw []byte
+		if raw, err = bson.Marshal(bson.M{"v": values}); err != nil {
+			return
+		}
+		wrapper := reflect.New(reflect.StructOf([]reflect.StructField{{Name: "V", Type: reflectValue.Elem().Type(), Tag: `bson:"v"`}}))
+		if err = bson.Unmarshal(raw, wrapper.Interface()); err != nil {
+			return
+		}
+		reflectValue.Elem().Set(wrapper.Elem().Field(0))
+		tx.RowsAffected = int64(len(values))
+		return
+	})
+}
+
+// Pluck 查询单个字段的值写入dest,dest 必须为指向Slice的指针,必须使用 Model 指定模型
+// column 支持使用 . 分隔的嵌套字段,不包含该字段的文档被忽略
+//
+//	var ids []int
+//	db.Model(&User{}).Pluck("Id", &ids, "lv > ?", 10)
+func (db *DB) Pluck(column string, dest any, where ...any) (tx *DB) {
+	tx = db.getInstance()
+	if len(where) > 0 {
+		tx = tx.Where(where[0], where[1:]...)
+	}
+	if tx.statement.model == nil {
+		return tx.Errorf(ErrModelValueRequired)
+	}
+	reflectValue := reflect.ValueOf(dest)
+	if reflectValue.Kind() != reflect.Ptr || reflectValue.Elem().Kind() != reflect.Slice {
+		return tx.Errorf("pluck dest must be a pointer to slice")
+	}
+	tx.statement.value = dest
+	return tx.callbacks.Call(tx, func(tx *DB) (err error) {
+		stmt := tx.statement
+		name := clause.DBName(stmt.schema, column)
+		opts := stmt.findOptions()
+		opts.SetProjection(bson.M{name: 1})
+		coll := stmt.collection()
+		var cursor *mongo.Cursor
+		if cursor, err = coll.Find(stmt.Context, stmt.Filter(), opts); err != nil {
+			return
+		}
+		defer func() {
+			_ = cursor.Close(stmt.Context)
+		}()
+		keys := strings.Split(name, clause.MongodbFieldSplit)
+		rows := reflectValue.Elem()
+		for cursor.Next(stmt.Context) {
+			raw, e := cursor.Current.LookupErr(keys...)
+			if e != nil {
+				continue
+			}
+			v := reflect.New(rows.Type().Elem())
+			if err = raw.Unmarshal(v.Interface()); err != nil {
+				return
+			}
+			rows = reflect.Append(rows, v.Elem())
+		}
+		if err = cursor.Err(); err != nil {
+			return
+		}
+		reflectValue.Elem().Set(rows)
+		tx.RowsAffected = int64(rows.Len())
+		return
+	})
+}
+
+// DistinctCount 统计字段不重复值的数量,count 必须为一个指向数字的指针  *int *int32 *int64
+// 使用聚合 $group + $count 实现,适用于不重复值较多,不适合使用Distinct返回所有值的场景
+func (db *DB) DistinctCount(field string, count interface{}, where ...any) (tx *DB) {
+	tx = db.getInstance()
+	if len(where) > 0 {
+		tx = tx.Where(where[0], where[1:]...)
+	}
+	tx.statement.value = count
+	return tx.callbacks.Call(tx, func(tx *DB) (err error) {
+		stmt := tx.statement
+		coll := stmt.collection()
+		pipeline := Pipeline{}
+		if filter := stmt.Filter(); len(filter) > 0 {
+			pipeline = pipeline.Match(filter)
+		}
+		pipeline = pipeline.Group(bson.M{"_id": "$" + stmt.DBName(field)}).Count("count")
+		var cursor *mongo.Cursor
+		if cursor, err = coll.Aggregate(stmt.Context, pipeline); err != nil {
+			return
+		}
+		var rows []struct {
+			Count int64 `bson:"count"`
+		}
+		if err = cursor.All(stmt.Context, &rows); err != nil {
+			return
+		}
+		var val int64
+		if len(rows) > 0 {
+			val = rows[0].Count
+		}
+		stmt.reflectValue.SetInt(val)
+		return
+	})
+}
+
+// GroupCount 按字段分组统计文档数量,结果按分组值升序写入dest,dest 必须为指向Slice的指针
+// 每条结果中 _id 为分组值,count 为数量
+//
+//	var rows []struct {
+//		Status string `bson:"_id"`
+//		Count  int    `bson:"count"`
+//	}
+//	db.Model(&User{}).GroupCount("Status", &rows, "lv > ?", 10)
+func (db *DB) GroupCount(field string, dest any, where ...any) (tx *DB) {
+	tx = db.getInstance()
+	if len(where) > 0 {
+		tx = tx.Where(where[0], where[1:]...)
+	}
+	reflectValue := reflect.ValueOf(dest)
+	if reflectValue.Kind() != reflect.Ptr || reflectValue.Elem().Kind() != reflect.Slice {
+		return tx.Errorf("group count dest must be a pointer to slice")
+	}
+	tx.statement.value = dest
+	return tx.callbacks.Call(tx, func(tx *DB) (err error) {
+		stmt := tx.statement
+		coll := stmt.collection()
+		pipeline := Pipeline{}
+		if filter := stmt.Filter(); len(filter) > 0 {
+			pipeline = pipeline.Match(filter)
+		}
+		pipeline = pipeline.Group(bson.M{"_id": "$" + stmt.DBName(field), "count": bson.M{"$sum": 1}}).Sort(bson.M{"_id": 1})
+		var cursor *mongo.Cursor
+		if cursor, err = coll.Aggregate(stmt.Context, pipeline); err != nil {
+			return
+		}
+		if err = cursor.All(stmt.Context, dest); err == nil {
+			tx.RowsAffected = int64(reflectValue.Elem().Len())
+		}
+		return
+	})
+}
+
+// Sum 统计数字字段的合计,没有匹配的文档时 result 为0并且 RowsAffected=0
+func (db *DB) Sum(field string, result *float64, where ...any) (tx *DB) {
+	return db.accumulate("$sum", field, result, where...)
+}
+
+// Avg 统计数字字段的平均值,没有匹配的文档时 result 为0并且 RowsAffected=0
+func (db *DB) Avg(field string, result *float64, where ...any) (tx *DB) {
+	return db.accumulate("$avg", field, result, where...)
+}
+
+// Min 统计数字字段的最小值,没有匹配的文档时 result 为0并且 RowsAffected=0
+func (db *DB) Min(field string, result *float64, where ...any) (tx *DB) {
+	return db.accumulate("$min", field, result, where...)
+}
+
+// Max 统计数字字段的最大值,没有匹配的文档时 result 为0并且 RowsAffected=0
+func (db *DB) Max(field string, result *float64, where ...any) (tx *DB) {
+	return db.accumulate("$max", field, result, where...)
+}
+
+// accumulate 使用 $group 累加器统计匹配文档的字段,RowsAffected 为匹配的文档数
+func (db *DB) accumulate(op string, field string, result *float64, where ...any) (tx *DB) {
+	tx = db.getInstance()
+	if len(where) > 0 {
+		tx = tx.Where(where[0], where[1:]...)
+	}
+	if result == nil {
+		return tx.Errorf("%v result is nil", op)
+	}
+	tx.statement.value = result
+	return tx.callbacks.Call(tx, func(tx *DB) (err error) {
+		stmt := tx.statement
+		coll := stmt.collection()
+		pipeline := Pipeline{}
+		if filter := stmt.Filter(); len(filter) > 0 {
+			pipeline = pipeline.Match(filter)
+		}
+		pipeline = pipeline.Group(bson.M{"_id": nil, "value": bson.M{op: "$" + stmt.DBName(field)}, "count": bson.M{"$sum": 1}})
+		var cursor *mongo.Cursor
+		if cursor, err = coll.Aggregate(stmt.Context, pipeline); err != nil {
+			return
+		}
+		var rows []struct {
+			Value float64 `bson:"value"`
+			Count int64   `bson:"count"`
+		}
+		if err = cursor.All(stmt.Context, &rows); err != nil {
+			return
+		}
+		*result = 0
+		if len(rows) > 0 {
+			*result = rows[0].Value
+			tx.RowsAffected = rows[0].Count
+		}
+		return
+	})
+}
+
+// FindOneAndDelete 删除一条记录并将删除前的文档写入val
+// 配合 Order 使用时删除排序后的第一条记录
+func (db *DB) FindOneAndDelete(val any, where ...any) (tx *DB) {
+	tx = db.getInstance()
+	if len(where) > 0 {
+		tx = tx.Where(where[0], where[1:]...)
+	}
+	tx.statement.value = val
+	return tx.callbacks.Call(tx, cmdFindOneAndDelete)
+}
+
+// FindOneAndReplace 使用replacement替换匹配的文档,并将结果写入replacement
+// 使用 ReturnDocument 选择返回替换前或替换后的文档,replacement 非指针时写入Model
+// replacement 中的 _id 和匹配文档不一致时数据库会返回错误
+func (db *DB) FindOneAndReplace(replacement any, where ...any) (tx *DB) {
+	tx = db.getInstance()
+	if len(where) > 0 {
+		tx = tx.Where(where[0], where[1:]...)
+	}
+	tx.statement.value = replacement
+	return tx.callbacks.Call(tx, cmdFindOneAndReplace)
+}
+
+// Cursor 流式查询中的一条原始记录,使用 Decode 解码
+type Cursor bson.Raw
+
+// Decode 将记录解码到i,i 必须为指针
+func (c Cursor) Decode(i any) error {
+	return bson.Unmarshal(c, i)
+}
+
+// Stream 流式查询,逐条读取游标避免大结果集一次性载入内存,必须使用 Model 指定模型
+// batch 每批从数据库读取的文档数量,<=0 时使用数据库默认值
+// ctx 取消时停止读取并关闭游标,结束或出错时关闭两个通道,错误通道最多返回一个错误
+//
+//	rows, errs := db.Model(&User{}).Where("lv > ?", 10).Stream(ctx, 1000)
+//	for row := range rows { row.Decode(&user) }
+//	if err := <-errs; err != nil {}
+func (db *DB) Stream(ctx context.Context, batch int, where ...any) (<-chan Cursor, <-chan error) {
+	rows := make(chan Cursor)
+	errs := make(chan error, 1)
+	tx := db.getInstance()
+	if len(where) > 0 {
+		tx = tx.Where(where[0], where[1:]...)
+	}
+	if tx.statement.model == nil {
+		tx.Error = ErrModelValueRequired
+	} else {
+		tx = tx.callbacks.Call(tx, streamHandle(ctx, batch, rows, errs))
+	}
+	if tx.Error != nil {
+		errs <- tx.Error
+	}
+	if tx.Error != nil || tx.dryRun {
+		close(rows)
+		close(errs)
+	}
+	return rows, errs
+}
+
+// streamHandle 执行查询并在后台逐条读取游标
+func streamHandle(ctx context.Context, batch int, rows chan<- Cursor, errs chan<- error) executeHandle {
+	return func(tx *DB) (err error) {
+		stmt := tx.statement
+		opts := stmt.findOptions()
+		if batch > 0 {
+			opts.SetBatchSize(int32(batch))
+		}
+		coll := stmt.collection()
+		var cursor *mongo.Cursor
+		if cursor, err = coll.Find(ctx, stmt.Filter(), opts); err != nil {
+			return
+		}
+		go streamCursor(ctx, cursor, rows, errs)
+		return
+	}
+}
+
+func streamCursor(ctx context.Context, cursor *mongo.Cursor, rows chan<- Cursor, errs chan<- error) {
+	defer close(errs)
+	defer close(rows)
+	defer func() {
+		_ = cursor.Close(context.Background())
+	}()
+	for cursor.Next(ctx) {
+		//cursor.Current 在下一次 Next 时会被复用
+		row := make(Cursor, len(cursor.Current))
+		copy(row, cursor.Current)
+		select {
+		case rows <- row:
+		case <-ctx.Done():
+			errs <- ctx.Err()
+			return
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		errs <- err
+	}
+}
@@ -0,0 +1,874 @@
+package cosmo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/hwcer/cosgo/schema"
+	"github.com/hwcer/cosmo/clause"
+	"github.com/hwcer/cosmo/update"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testItem struct {
+	Id     int    `bson:"_id"`
+	Name   string `bson:"name"`
+	Status string `bson:"status"`
+	Lv     int    `bson:"lv"`
+}
+
+// resetItems 清空并写入测试数据
+func resetItems(t *testing.T, db *DB, items ...*testItem) {
+	_, coll := db.Collection(&testItem{})
+	if _, err := coll.DeleteMany(db.statement.Context, bson.M{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(items) > 0 {
+		if tx := db.Create(items); tx.Error != nil {
+			t.Fatal(tx.Error)
+		}
+	}
+}
+
+func testItems() []*testItem {
+	return []*testItem{
+		{Id: 1, Name: "a", Status: "active", Lv: 1},
+		{Id: 2, Name: "b", Status: "active", Lv: 2},
+		{Id: 3, Name: "c", Status: "closed", Lv: 3},
+	}
+}
+
+func TestWhereIsNull(t *testing.T) {
+	db := newTestDB(t)
+	resetItems(t, db)
+	_, coll := db.Collection(&testItem{})
+	docs := []any{bson.M{"_id": 1, "name": nil}, bson.M{"_id": 2}, bson.M{"_id": 3, "name": "c"}}
+	if _, err := coll.InsertMany(db.statement.Context, docs); err != nil {
+		t.Fatal(err)
+	}
+	//值为 null 和字段不存在都匹配 IS NULL
+	var rows []*testItem
+	if tx := db.Order("_id", 1).Find(&rows, "name IS NULL"); tx.Error != nil || len(rows) != 2 || rows[0].Id != 1 || rows[1].Id != 2 {
+		t.Fatalf("IS NULL error:%v,%v", tx.Error, len(rows))
+	}
+	rows = nil
+	if tx := db.Find(&rows, "name IS NOT NULL"); tx.Error != nil || len(rows) != 1 || rows[0].Id != 3 {
+		t.Fatalf("IS NOT NULL error:%v,%v", tx.Error, len(rows))
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	p := Pipeline{}.Match(bson.M{"lv": 1}).Stage("limit", int64(10))
+	want := Pipeline{{{Key: "$match", Value: bson.M{"lv": 1}}}, {{Key: "$limit", Value: int64(10)}}}
+	if !reflect.DeepEqual(p, want) {
+		t.Fatalf("Pipeline error:%v", p)
+	}
+	if err := p.Err(); err != nil {
+		t.Fatalf("Pipeline Err:%v", err)
+	}
+	//阶段名为空
+	p = Pipeline{}.Match(bson.M{"lv": 1}).Stage("", int64(10))
+	if !errors.Is(p.Err(), ErrInvalidPipeline) {
+		t.Fatalf("empty stage name Err:%v", p.Err())
+	}
+	var rows []bson.M
+	if tx := New().Model(&testItem{}).Aggregate(p, &rows); !errors.Is(tx.Error, ErrInvalidPipeline) {
+		t.Fatalf("Aggregate empty stage name error:%v", tx.Error)
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	db := newTestDB(t)
+	resetItems(t, db, testItems()...)
+	var rows []bson.M
+	pipeline := Pipeline{}.Match(bson.M{"lv": bson.M{"$gte": 1}}).Group(bson.M{"_id": "$status", "count": bson.M{"$sum": 1}}).Sort(bson.D{{Key: "_id", Value: 1}})
+	if tx := db.Model(&testItem{}).AllowDiskUse().Aggregate(pipeline, &rows); tx.Error != nil {
+		t.Fatal(tx.Error)
+	} else if tx.RowsAffected != 2 {
+		t.Fatalf("RowsAffected:%v", tx.RowsAffected)
+	}
+	if rows[0]["_id"] != "active" || rows[0]["count"] != int32(2) {
+		t.Fatalf("Aggregate result error:%v", rows)
+	}
+}
+
+func TestDistinct(t *testing.T) {
+	db := newTestDB(t)
+	resetItems(t, db, testItems()...)
+	var status []string
+	if tx := db.Model(&testItem{}).Distinct("Status", &status); tx.Error != nil {
+		t.Fatal(tx.Error)
+	} else if tx.RowsAffected != 2 || len(status) != 2 {
+		t.Fatalf("Distinct string error:%v", status)
+	}
+	var lv []int
+	if tx := db.Model(&testItem{}).Distinct("Lv", &lv, "status = ?", "active"); tx.Error != nil {
+		t.Fatal(tx.Error)
+	} else if !reflect.DeepEqual(lv, []int{1, 2}) {
+		t.Fatalf("Distinct int error:%v", lv)
+	}
+	var empty []int
+	if tx := db.Model(&testItem{}).Distinct("Lv", &empty, "status = ?", "none"); tx.Error != nil || tx.RowsAffected != 0 || len(empty) != 0 {
+		t.Fatalf("Distinct empty error:%v,%v", tx.Error, empty)
+	}
+}
+
+func TestDistinctCount(t *testing.T) {
+	db := newTestDB(t)
+	resetItems(t, db, testItems()...)
+	var count int
+	if tx := db.Model(&testItem{}).DistinctCount("Status", &count); tx.Error != nil {
+		t.Fatal(tx.Error)
+	} else if count != 2 {
+		t.Fatalf("DistinctCount error:%v", count)
+	}
+	if tx := db.Model(&testItem{}).DistinctCount("Lv", &count, "status = ?", "none"); tx.Error != nil {
+		t.Fatal(tx.Error)
+	} else if count != 0 {
+		t.Fatalf("DistinctCount empty error:%v", count)
+	}
+}
+
+func TestFindOneAndDelete(t *testing.T) {
+	db := newTestDB(t)
+	resetItems(t, db, testItems()...)
+	item := &testItem{}
+	if tx := db.Order("Lv", -1).FindOneAndDelete(item, "status = ?", "active"); tx.Error != nil {
+		t.Fatal(tx.Error)
+	} else if tx.RowsAffected != 1 || item.Id != 2 {
+		t.Fatalf("FindOneAndDelete error:%+v", item)
+	}
+	item = &testItem{}
+	if tx := db.FindOneAndDelete(item, 2); tx.Error != nil {
+		t.Fatal(tx.Error)
+	} else if tx.RowsAffected != 0 {
+		t.Fatalf("FindOneAndDelete deleted twice")
+	}
+}
+
+func TestFindOneAndReplace(t *testing.T) {
+	db := newTestDB(t)
+	resetItems(t, db, testItems()...)
+	item := &testItem{Id: 1, Name: "replaced", Status: "closed", Lv: 9}
+	if tx := db.FindOneAndReplace(item, 1); tx.Error != nil {
+		t.Fatal(tx.Error)
+	} else if tx.RowsAffected != 1 || item.Name != "replaced" {
+		t.Fatalf("FindOneAndReplace error:%+v", item)
+	}
+	old := &testItem{Id: 1, Name: "again"}
+	if tx := db.ReturnDocument(options.Before).FindOneAndReplace(old, 1); tx.Error != nil {
+		t.Fatal(tx.Error)
+	} else if old.Name != "replaced" {
+		t.Fatalf("FindOneAndReplace before error:%+v", old)
+	}
+	item = &testItem{Id: 10, Name: "new"}
+	if tx := db.Upsert().FindOneAndReplace(item, 10); tx.Error != nil {
+		t.Fatal(tx.Error)
+	} else if tx.RowsAffected != 1 || item.Name != "new" {
+		t.Fatalf("FindOneAndReplace upsert error:%+v", item)
+	}
+	if tx := db.FindOneAndReplace(&testItem{Id: 99}, 2); tx.Error == nil {
+		t.Fatalf("FindOneAndReplace with different _id should fail")
+	}
+}
+
+type testCounter struct {
+	Id    string `bson:"_id"`
+	Value int64  `bson:"value"`
+}
+
+func TestCounter(t *testing.T) {
+	db := newTestDB(t)
+	db.Model(&testCounter{}).Delete("user")
+	for i := int64(1); i <= 3; i++ {
+		if v, err := db.Model(&testCounter{}).Counter("user", "Value", 1); err != nil {
+			t.Fatal(err)
+		} else if v != i {
+			t.Fatalf("Counter want %v,got %v", i, v)
+		}
+	}
+	if v, err := db.Model(&testCounter{}).Counter("user", "Value", -2); err != nil || v != 1 {
+		t.Fatalf("Counter decrement error:%v,%v", v, err)
+	}
+}
+
+func TestEstimatedCount(t *testing.T) {
+	db := newTestDB(t)
+	resetItems(t, db, testItems()...)
+	var count int64
+	if tx := db.Model(&testItem{}).EstimatedCount(&count); tx.Error != nil || count != 3 {
+		t.Fatalf("EstimatedCount error:%v,%v", count, tx.Error)
+	}
+	if tx := db.Model(&testItem{}).EstimatedCount(&count, "status = ?", "active"); tx.Error != nil || count != 2 {
+		t.Fatalf("EstimatedCount with filter error:%v,%v", count, tx.Error)
+	}
+}
+
+type testVersion struct {
+	Id      int    `bson:"_id"`
+	Name    string `bson:"name"`
+	Version int64  `bson:"version" cosmo:"version"`
+}
+
+func TestVersionField(t *testing.T) {
+	sch, err := schema.Parse(&testVersion{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if field := LookUpTagField(sch, TagVersion); field == nil || field.DBName != "version" {
+		t.Fatalf("version field not found")
+	}
+}
+
+func TestVersionConflict(t *testing.T) {
+	db := newTestDB(t)
+	db.Model(&testVersion{}).Delete(1)
+	doc := &testVersion{Id: 1, Name: "v0"}
+	if tx := db.Create(doc); tx.Error != nil {
+		t.Fatal(tx.Error)
+	}
+	stale := *doc
+	doc.Name = "v1"
+	if tx := db.Update(doc, 1); tx.Error != nil {
+		t.Fatal(tx.Error)
+	} else if doc.Version != 1 {
+		t.Fatalf("version not increased:%v", doc.Version)
+	}
+	stale.Name = "stale"
+	if tx := db.Update(&stale, 1); !errors.Is(tx.Error, ErrVersionConflict) {
+		t.Fatalf("want ErrVersionConflict,got:%v", tx.Error)
+	}
+}
+
+func TestHintIndex(t *testing.T) {
+	db := newTestDB(t)
+	resetItems(t, db, testItems()...)
+	_, coll := db.Collection(&testItem{})
+	index := mongo.IndexModel{Keys: bson.D{{Key: "status", Value: 1}}, Options: options.Index().SetName("idx_test_status")}
+	if _, err := coll.Indexes().CreateOne(db.statement.Context, index); err != nil {
+		t.Fatal(err)
+	}
+	var rows []*testItem
+	if tx := db.Hint("idx_test_status").Find(&rows, "status = ?", "active"); tx.Error != nil || len(rows) != 2 {
+		t.Fatalf("Hint find error:%v,%v", tx.Error, len(rows))
+	}
+	var count int
+	if tx := db.Model(&testItem{}).Hint("idx_test_status").Count(&count); tx.Error != nil || count != 3 {
+		t.Fatalf("Hint count error:%v,%v", tx.Error, count)
+	}
+	if tx := db.Hint("idx_not_exist").Find(&rows); tx.Error == nil {
+		t.Fatalf("invalid hint should return error")
+	}
+}
+
+type testProfile struct {
+	Id   primitive.ObjectID `bson:"_id"`
+	Name string             `bson:"name"`
+	Lv   int                `bson:"lv"`
+}
+
+func TestUpsertReturn(t *testing.T) {
+	db := newTestDB(t)
+	_, coll := db.Collection(&testProfile{})
+	_, _ = coll.DeleteMany(db.statement.Context, bson.M{})
+	created := &testProfile{Name: "hwc", Lv: 1}
+	if tx := db.UpsertReturn(created, "name = ?", "hwc"); tx.Error != nil {
+		t.Fatal(tx.Error)
+	} else if created.Id.IsZero() || created.Lv != 1 {
+		t.Fatalf("UpsertReturn create error:%+v", created)
+	}
+	got := &testProfile{Name: "hwc", Lv: 9}
+	if tx := db.UpsertReturn(got, "name = ?", "hwc"); tx.Error != nil {
+		t.Fatal(tx.Error)
+	} else if got.Id != created.Id || got.Lv != 1 {
+		t.Fatalf("UpsertReturn get error:%+v", got)
+	}
+}
+
+func TestCollationOrder(t *testing.T) {
+	db := newTestDB(t)
+	resetItems(t, db, &testItem{Id: 1, Name: "b"}, &testItem{Id: 2, Name: "A"}, &testItem{Id: 3, Name: "a"}, &testItem{Id: 4, Name: "B"})
+	var rows []*testItem
+	c := &options.Collation{Locale: "en", Strength: 2}
+	if tx := db.Collation(c).Order("Name", 1).Order("_id", 1).Find(&rows); tx.Error != nil {
+		t.Fatal(tx.Error)
+	}
+	var ids []int
+	for _, v := range rows {
+		ids = append(ids, v.Id)
+	}
+	if !reflect.DeepEqual(ids, []int{2, 3, 1, 4}) {
+		t.Fatalf("collation order error:%v", ids)
+	}
+}
+
+func TestStream(t *testing.T) {
+	db := newTestDB(t)
+	var items []*testItem
+	for i := 1; i <= 5; i++ {
+		items = append(items, &testItem{Id: i, Name: fmt.Sprintf("n%v", i), Lv: i})
+	}
+	resetItems(t, db, items...)
+	rows, errs := db.Model(&testItem{}).Order("_id", 1).Stream(context.Background(), 2, "lv > ?", 1)
+	var ids []int
+	for row := range rows {
+		item := &testItem{}
+		if err := row.Decode(item); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, item.Id)
+	}
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ids, []int{2, 3, 4, 5}) {
+		t.Fatalf("Stream result error:%v", ids)
+	}
+	//消费者提前取消,游标关闭并返回 context 错误
+	ctx, cancel := context.WithCancel(context.Background())
+	rows, errs = db.Model(&testItem{}).Stream(ctx, 1)
+	<-rows
+	cancel()
+	for range rows {
+	}
+	if err := <-errs; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Stream cancel error:%v", err)
+	}
+}
+
+func TestStreamError(t *testing.T) {
+	rows, errs := New().Table("items").Stream(context.Background(), 10)
+	if _, ok := <-rows; ok {
+		t.Fatalf("rows should be closed")
+	}
+	if err := <-errs; !errors.Is(err, ErrModelValueRequired) {
+		t.Fatalf("Stream without model error:%v", err)
+	}
+}
+
+func TestSoftDelete(t *testing.T) {
+	db := newTestDB(t)
+	_, coll := db.Collection(&testSoftDelete{})
+	if _, err := coll.DeleteMany(db.statement.Context, bson.M{}); err != nil {
+		t.Fatal(err)
+	}
+	rows := []*testSoftDelete{{Id: 1, Name: "a"}, {Id: 2, Name: "b"}, {Id: 3, Name: "c"}}
+	if tx := db.Create(rows); tx.Error != nil {
+		t.Fatal(tx.Error)
+	}
+	if tx := db.Model(&testSoftDelete{}).Delete(1); tx.Error != nil || tx.RowsAffected != 1 {
+		t.Fatalf("soft delete error:%v,%v", tx.Error, tx.RowsAffected)
+	}
+	var count int64
+	if tx := db.Model(&testSoftDelete{}).Count(&count); tx.Error != nil || count != 2 {
+		t.Fatalf("soft delete count error:%v,%v", tx.Error, count)
+	}
+	//批量软删除
+	if tx := db.Model(&testSoftDelete{}).Delete("name = ?", "b"); tx.Error != nil || tx.RowsAffected != 1 {
+		t.Fatalf("bulk soft delete error:%v,%v", tx.Error, tx.RowsAffected)
+	}
+	var list []*testSoftDelete
+	if tx := db.Model(&testSoftDelete{}).Find(&list); tx.Error != nil || len(list) != 1 {
+		t.Fatalf("soft delete find error:%v,%v", tx.Error, len(list))
+	}
+	//Unscoped 查询包含已删除文档
+	list = nil
+	if tx := db.Model(&testSoftDelete{}).Unscoped().Find(&list); tx.Error != nil || len(list) != 3 {
+		t.Fatalf("unscoped find error:%v,%v", tx.Error, len(list))
+	}
+	for _, v := range list {
+		if (v.Id == 3) != (v.Deleted == 0) {
+			t.Fatalf("soft delete marker error:%+v", v)
+		}
+	}
+	//Unscoped 物理删除
+	if tx := db.Model(&testSoftDelete{}).Unscoped().Delete(1); tx.Error != nil || tx.RowsAffected != 1 {
+		t.Fatalf("unscoped delete error:%v,%v", tx.Error, tx.RowsAffected)
+	}
+	if n, err := coll.CountDocuments(db.statement.Context, bson.M{}); err != nil || n != 2 {
+		t.Fatalf("unscoped delete count error:%v,%v", err, n)
+	}
+}
+
+func TestUpsertInsertID(t *testing.T) {
+	db := newTestDB(t)
+	_, coll := db.Collection(&testProfile{})
+	_, _ = coll.DeleteMany(db.statement.Context, bson.M{})
+	tx := db.Model(&testProfile{}).Upsert().Update(bson.M{"lv": 1}, "name = ?", "upsert")
+	if tx.Error != nil {
+		t.Fatal(tx.Error)
+	}
+	id, ok := tx.LastInsertID.(primitive.ObjectID)
+	if !ok || id.IsZero() || tx.RowsAffected != 1 {
+		t.Fatalf("upsert insert error:%v,%v", tx.LastInsertID, tx.RowsAffected)
+	}
+	p := &testProfile{}
+	if tx = db.Find(p, id); tx.Error != nil || p.Name != "upsert" {
+		t.Fatalf("upsert document error:%v,%+v", tx.Error, p)
+	}
+	//匹配但未修改
+	tx = db.Model(&testProfile{}).Upsert().Update(bson.M{"lv": 1}, "name = ?", "upsert")
+	if tx.Error != nil || tx.RowsAffected != 1 || tx.LastInsertID != nil {
+		t.Fatalf("upsert match error:%v,%v,%v", tx.Error, tx.RowsAffected, tx.LastInsertID)
+	}
+}
+
+func TestCreateBatches(t *testing.T) {
+	if r := createBatches(250, 100); !reflect.DeepEqual(r, [][2]int{{0, 100}, {100, 200}, {200, 250}}) {
+		t.Fatalf("createBatches error:%v", r)
+	}
+	if r := createBatches(3, 0); !reflect.DeepEqual(r, [][2]int{{0, 3}}) {
+		t.Fatalf("createBatches without size error:%v", r)
+	}
+}
+
+func TestCreateInBatches(t *testing.T) {
+	db := newTestDB(t)
+	resetItems(t, db)
+	var items []*testItem
+	for i := 1; i <= 250; i++ {
+		items = append(items, &testItem{Id: i, Lv: i})
+	}
+	if tx := db.CreateInBatches(items, 100); tx.Error != nil || tx.RowsAffected != 250 {
+		t.Fatalf("CreateInBatches error:%v,%v", tx.Error, tx.RowsAffected)
+	}
+	//第二批中存在重复主键,第一批写入后停止
+	items = []*testItem{{Id: 251}, {Id: 252}, {Id: 1}, {Id: 253}}
+	tx := db.CreateInBatches(items, 2)
+	if tx.Error == nil || tx.RowsAffected != 2 || !strings.Contains(tx.Error.Error(), "batch 1") {
+		t.Fatalf("CreateInBatches stop on error:%v,%v", tx.Error, tx.RowsAffected)
+	}
+}
+
+func TestPluck(t *testing.T) {
+	db := newTestDB(t)
+	resetItems(t, db, testItems()...)
+	_, coll := db.Collection(&testItem{})
+	//不包含 lv 字段的文档被忽略
+	if _, err := coll.InsertOne(db.statement.Context, bson.M{"_id": 9, "name": "x"}); err != nil {
+		t.Fatal(err)
+	}
+	var lv []int
+	if tx := db.Model(&testItem{}).Order("_id", 1).Pluck("Lv", &lv); tx.Error != nil {
+		t.Fatal(tx.Error)
+	}
+	if !reflect.DeepEqual(lv, []int{1, 2, 3}) {
+		t.Fatalf("Pluck error:%v", lv)
+	}
+	var names []string
+	if tx := db.Model(&testItem{}).Order("_id", 1).Pluck("name", &names, "status = ?", "active"); tx.Error != nil {
+		t.Fatal(tx.Error)
+	} else if !reflect.DeepEqual(names, []string{"a", "b"}) || tx.RowsAffected != 2 {
+		t.Fatalf("Pluck with where error:%v", names)
+	}
+	if tx := db.Model(&testItem{}).Pluck("lv", lv); tx.Error == nil {
+		t.Fatalf("Pluck dest must be pointer")
+	}
+}
+
+func TestExists(t *testing.T) {
+	if _, err := New().Exists("name = ?", "a"); !errors.Is(err, ErrModelValueRequired) {
+		t.Fatalf("Exists without model error:%v", err)
+	}
+	db := newTestDB(t)
+	resetItems(t, db, testItems()...)
+	if ok, err := db.Model(&testItem{}).Exists("status = ?", "closed"); err != nil || !ok {
+		t.Fatalf("Exists error:%v,%v", ok, err)
+	}
+	if ok, err := db.Model(&testItem{}).Exists("status = ?", "none"); err != nil || ok {
+		t.Fatalf("Exists not match error:%v,%v", ok, err)
+	}
+}
+
+func TestExplainFind(t *testing.T) {
+	tx := New().Model(&testItem{}).Where("lv > ?", 1).Order("Lv", -1).Limit(10).Select("Name")
+	if tx = tx.statement.Parse(); tx.Error != nil {
+		t.Fatal(tx.Error)
+	}
+	want := bson.D{
+		{Key: "find", Value: "testitem"},
+		{Key: "filter", Value: clause.Filter{"lv": bson.M{"$gt": 1}}},
+		{Key: "sort", Value: bson.D{{Key: "lv", Value: -1}}},
+		{Key: "projection", Value: bson.M{"name": true}},
+		{Key: "limit", Value: int64(10)},
+	}
+	if cmd := explainFind(tx.statement); !reflect.DeepEqual(cmd, want) {
+		t.Fatalf("explain command error:%v", cmd)
+	}
+	if _, err := New().Model(&testItem{}).Explain("all"); err == nil {
+		t.Fatalf("Explain verbosity should be checked")
+	}
+}
+
+func TestExplain(t *testing.T) {
+	db := newTestDB(t)
+	resetItems(t, db, testItems()...)
+	plan, err := db.Model(&testItem{}).Where("lv > ?", 1).Explain("executionStats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := plan["queryPlanner"]; !ok {
+		t.Fatalf("Explain result error:%v", plan)
+	}
+}
+
+func TestWhereError(t *testing.T) {
+	db := New()
+	if tx := db.Model(&testItem{}).Where("name ~ ?", "a").Delete(); !errors.Is(tx.Error, clause.ErrInvalidWhere) {
+		t.Fatalf("Delete with invalid where error:%v", tx.Error)
+	}
+	if tx := db.Model(&testItem{}).Where(func() {}).Update(bson.M{"lv": 1}); !errors.Is(tx.Error, clause.ErrInvalidWhere) {
+		t.Fatalf("Update with invalid where error:%v", tx.Error)
+	}
+	var items []*testItem
+	if tx := db.Where("status = active OR lv").Find(&items); !errors.Is(tx.Error, clause.ErrInvalidWhere) {
+		t.Fatalf("Find with invalid where error:%v", tx.Error)
+	}
+}
+
+func TestBitsQuery(t *testing.T) {
+	db := newTestDB(t)
+	resetItems(t, db, testItems()...)
+	filter := clause.Filter{}
+	filter.BitsAllSet("lv", 1)
+	var rows []*testItem
+	if tx := db.Order("_id", 1).Find(&rows, filter); tx.Error != nil || len(rows) != 2 || rows[0].Id != 1 || rows[1].Id != 3 {
+		t.Fatalf("BitsAllSet find error:%v,%v", tx.Error, len(rows))
+	}
+	filter = clause.Filter{}
+	filter.BitsAllSet("lv", []int{0, 1})
+	if tx := db.Find(&rows, filter); tx.Error != nil || len(rows) != 1 || rows[0].Id != 3 {
+		t.Fatalf("BitsAllSet positions find error:%v,%v", tx.Error, len(rows))
+	}
+}
+
+func TestPageTotal(t *testing.T) {
+	db := newTestDB(t)
+	resetItems(t, db, testItems()...)
+	var rows []*testItem
+	paging := &Paging{Page: 2, Size: 2, Rows: &rows}
+	if tx := db.Model(&testItem{}).Order("_id", 1).Page(paging); tx.Error != nil {
+		t.Fatal(tx.Error)
+	}
+	if paging.Record != 3 || paging.Total != 2 || len(rows) != 1 || rows[0].Id != 3 {
+		t.Fatalf("Page result error:%+v", paging)
+	}
+	rows = nil
+	paging = &Paging{Size: 5, Rows: &rows}
+	if tx := db.Model(&testItem{}).Page(paging, "status = ?", "active"); tx.Error != nil || tx.RowsAffected != 2 {
+		t.Fatalf("Page where error:%v,%v", tx.Error, tx.RowsAffected)
+	}
+	if paging.Record != 2 || paging.Total != 1 {
+		t.Fatalf("Page where result error:%+v", paging)
+	}
+}
+
+func TestRange(t *testing.T) {
+	if tx := New().Table("items").Range(func(Cursor) bool { return true }); tx.Error != ErrModelValueRequired {
+		t.Fatalf("Range without model error:%v", tx.Error)
+	}
+	db := newTestDB(t)
+	resetItems(t, db, testItems()...)
+	var ids []int
+	tx := db.Model(&testItem{}).Order("_id", -1).Range(func(c Cursor) bool {
+		item := &testItem{}
+		if err := c.Decode(item); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, item.Id)
+		return true
+	})
+	if tx.Error != nil || tx.RowsAffected != 3 || !reflect.DeepEqual(ids, []int{3, 2, 1}) {
+		t.Fatalf("Range error:%v,%v", tx.Error, ids)
+	}
+	//handle 返回 false 时停止
+	ids = nil
+	tx = db.Model(&testItem{}).Range(func(c Cursor) bool {
+		ids = append(ids, 0)
+		return false
+	}, "status = ?", "active")
+	if tx.Error != nil || tx.RowsAffected != 1 || len(ids) != 1 {
+		t.Fatalf("Range stop error:%v,%v", tx.Error, ids)
+	}
+}
+
+func TestFirstLast(t *testing.T) {
+	db := newTestDB(t)
+	resetItems(t, db, testItems()...)
+	item := &testItem{}
+	if tx := db.First(item); tx.Error != nil || item.Id != 1 {
+		t.Fatalf("First error:%v,%v", tx.Error, item.Id)
+	}
+	item = &testItem{}
+	if tx := db.Last(item); tx.Error != nil || item.Id != 3 {
+		t.Fatalf("Last error:%v,%v", tx.Error, item.Id)
+	}
+	item = &testItem{}
+	if tx := db.Last(item, "status = ?", "active"); tx.Error != nil || item.Id != 2 {
+		t.Fatalf("Last where error:%v,%v", tx.Error, item.Id)
+	}
+	//已经设置排序时不使用默认排序
+	item = &testItem{}
+	if tx := db.Order("Lv", 1).Last(item); tx.Error != nil || item.Id != 1 {
+		t.Fatalf("Last with Order error:%v,%v", tx.Error, item.Id)
+	}
+}
+
+func TestGroupCount(t *testing.T) {
+	var rows []struct {
+		Status string `bson:"_id"`
+		Count  int    `bson:"count"`
+	}
+	if tx := New().Model(&testItem{}).GroupCount("Status", rows); tx.Error == nil {
+		t.Fatalf("GroupCount should reject non pointer dest")
+	}
+	db := newTestDB(t)
+	resetItems(t, db, testItems()...)
+	if tx := db.Model(&testItem{}).GroupCount("Status", &rows); tx.Error != nil || tx.RowsAffected != 2 {
+		t.Fatalf("GroupCount error:%v", tx.Error)
+	}
+	if len(rows) != 2 || rows[0].Status != "active" || rows[0].Count != 2 || rows[1].Status != "closed" || rows[1].Count != 1 {
+		t.Fatalf("GroupCount result error:%+v", rows)
+	}
+	rows = nil
+	if tx := db.Model(&testItem{}).GroupCount("status", &rows, "lv > ?", 1); tx.Error != nil {
+		t.Fatal(tx.Error)
+	}
+	if len(rows) != 2 || rows[0].Count != 1 || rows[1].Count != 1 {
+		t.Fatalf("GroupCount where result error:%+v", rows)
+	}
+}
+
+func TestAccumulate(t *testing.T) {
+	if tx := New().Model(&testItem{}).Sum("Lv", nil); tx.Error == nil {
+		t.Fatalf("Sum should reject nil result")
+	}
+	db := newTestDB(t)
+	resetItems(t, db, testItems()...)
+	var v float64
+	if tx := db.Model(&testItem{}).Sum("Lv", &v); tx.Error != nil || v != 6 || tx.RowsAffected != 3 {
+		t.Fatalf("Sum error:%v,%v", tx.Error, v)
+	}
+	if tx := db.Model(&testItem{}).Avg("Lv", &v, "status = ?", "active"); tx.Error != nil || v != 1.5 || tx.RowsAffected != 2 {
+		t.Fatalf("Avg error:%v,%v", tx.Error, v)
+	}
+	if tx := db.Model(&testItem{}).Min("lv", &v); tx.Error != nil || v != 1 {
+		t.Fatalf("Min error:%v,%v", tx.Error, v)
+	}
+	if tx := db.Model(&testItem{}).Max("lv", &v); tx.Error != nil || v != 3 {
+		t.Fatalf("Max error:%v,%v", tx.Error, v)
+	}
+	//没有匹配的文档
+	if tx := db.Model(&testItem{}).Sum("Lv", &v, "status = ?", "none"); tx.Error != nil || v != 0 || tx.RowsAffected != 0 {
+		t.Fatalf("Sum empty error:%v,%v,%v", tx.Error, v, tx.RowsAffected)
+	}
+}
+
+func TestCountContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var n int64
+	if tx := New().WithContext(ctx).Model(&testItem{}).Count(&n); !errors.Is(tx.Error, context.Canceled) {
+		t.Fatalf("Count with canceled context error:%v", tx.Error)
+	}
+	db := newTestDB(t)
+	resetItems(t, db, testItems()...)
+	if tx := db.WithContext(ctx).Model(&testItem{}).Count(&n); !errors.Is(tx.Error, context.Canceled) || n != 0 {
+		t.Fatalf("Count with canceled context error:%v,%v", tx.Error, n)
+	}
+	timeout, done := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer done()
+	time.Sleep(time.Millisecond)
+	if tx := db.WithContext(timeout).Model(&testItem{}).Count(&n); !errors.Is(tx.Error, context.DeadlineExceeded) {
+		t.Fatalf("Count with expired context error:%v", tx.Error)
+	}
+	if tx := db.Model(&testItem{}).Hint("_id_").Count(&n, "status = ?", "active"); tx.Error != nil || n != 2 {
+		t.Fatalf("Count error:%v,%v", tx.Error, n)
+	}
+}
+
+type testSave struct {
+	Id      int    `bson:"_id"`
+	Name    string `bson:"name"`
+	Created int64  `bson:"created"`
+}
+
+func (s *testSave) SetOnInsert() (map[string]any, error) {
+	return map[string]any{"Created": s.Created}, nil
+}
+
+func TestMergeSetOnInsert(t *testing.T) {
+	val := &testSave{Id: 1, Name: "a", Created: 100}
+	tx := New().Model(val)
+	tx.statement.value = val
+	if tx = tx.statement.Parse(); tx.Error != nil {
+		t.Fatal(tx.Error)
+	}
+	data, _, err := update.Build(val, tx.statement.schema, &tx.statement.selector)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//普通更新时 $set 中的字段优先
+	if _, ok := data[update.UpdateTypeSetOnInsert]; ok {
+		t.Fatalf("Build should drop $setOnInsert fields already in $set:%v", data)
+	}
+	if err = mergeSetOnInsert(tx.statement, data); err != nil {
+		t.Fatal(err)
+	}
+	want := update.Update{update.UpdateTypeSet: {"name": "a"}, update.UpdateTypeSetOnInsert: {"created": int64(100)}}
+	if !reflect.DeepEqual(data, want) {
+		t.Fatalf("mergeSetOnInsert error:%v", data)
+	}
+}
+
+func TestSaveOrMerge(t *testing.T) {
+	db := newTestDB(t)
+	_, coll := db.Collection(&testSave{})
+	if _, err := coll.DeleteMany(db.statement.Context, bson.M{}); err != nil {
+		t.Fatal(err)
+	}
+	if tx := db.SaveOrMerge(&testSave{Id: 1, Name: "a", Created: 100}, 1); tx.Error != nil || tx.RowsAffected != 1 {
+		t.Fatalf("SaveOrMerge insert error:%v", tx.Error)
+	}
+	if tx := db.SaveOrMerge(&testSave{Id: 1, Name: "b", Created: 200}, 1); tx.Error != nil {
+		t.Fatal(tx.Error)
+	}
+	row := &testSave{}
+	if tx := db.Find(row, 1); tx.Error != nil {
+		t.Fatal(tx.Error)
+	}
+	if row.Name != "b" || row.Created != 100 {
+		t.Fatalf("SaveOrMerge result error:%+v", row)
+	}
+}
+
+func TestScan(t *testing.T) {
+	type itemDTO struct {
+		Id   int    `bson:"_id"`
+		Name string `bson:"name"`
+	}
+	var dto itemDTO
+	if tx := New().Table("items").Scan(&dto); tx.Error != ErrModelValueRequired {
+		t.Fatalf("Scan without model error:%v", tx.Error)
+	}
+	if tx := New().Model(&testItem{}).Scan(dto); tx.Error == nil {
+		t.Fatalf("Scan should reject non pointer dest")
+	}
+	//使用模型的字段名称
+	tx := New().Session(&Session{DryRun: true}).Model(&testItem{}).Select("Id", "Name").Scan(&dto, "Lv > ?", 1)
+	if r := tx.DryRunResult(); tx.Error != nil || !reflect.DeepEqual(r.Filter, clause.Filter{"lv": bson.M{"$gt": 1}}) || !reflect.DeepEqual(r.Projection, bson.M{"_id": true, "name": true}) {
+		t.Fatalf("Scan dry run error:%v,%+v", tx.Error, r)
+	}
+	db := newTestDB(t)
+	resetItems(t, db, testItems()...)
+	var rows []itemDTO
+	if tx := db.Model(&testItem{}).Order("_id", 1).Scan(&rows, "Status = ?", "active"); tx.Error != nil || tx.RowsAffected != 2 {
+		t.Fatalf("Scan slice error:%v", tx.Error)
+	}
+	if !reflect.DeepEqual(rows, []itemDTO{{Id: 1, Name: "a"}, {Id: 2, Name: "b"}}) {
+		t.Fatalf("Scan slice result error:%+v", rows)
+	}
+	if tx := db.Model(&testItem{}).Scan(&dto, 3); tx.Error != nil || dto.Name != "c" {
+		t.Fatalf("Scan struct error:%v,%+v", tx.Error, dto)
+	}
+}
+
+func TestUpdatesSelector(t *testing.T) {
+	dry := New().Session(&Session{DryRun: true})
+	tx := dry.Model(&testItem{}).Select("Name").Updates(&testItem{Name: "x", Lv: 9}, "Lv > ?", 1)
+	if r := tx.DryRunResult(); tx.Error != nil || !reflect.DeepEqual(r.Update, update.Update{update.UpdateTypeSet: {"name": "x"}}) {
+		t.Fatalf("Updates with Select error:%v,%+v", tx.Error, r)
+	}
+	if !tx.statement.multiple || tx.statement.updateAndModifyModel {
+		t.Fatalf("Updates should update multiple documents")
+	}
+	tx = dry.Model(&testItem{}).Omit("Name").Updates(&testItem{Name: "x", Lv: 9}, "Lv > ?", 1)
+	if r := tx.DryRunResult(); tx.Error != nil || !reflect.DeepEqual(r.Update, update.Update{update.UpdateTypeSet: {"lv": 9}}) {
+		t.Fatalf("Updates with Omit error:%v,%+v", tx.Error, r)
+	}
+	db := newTestDB(t)
+	resetItems(t, db, testItems()...)
+	if tx = db.Model(&testItem{}).Select("Name").Updates(&testItem{Name: "x", Lv: 9}, "lv > ?", 1); tx.Error != nil || tx.RowsAffected != 2 {
+		t.Fatalf("Updates error:%v,%v", tx.Error, tx.RowsAffected)
+	}
+	var rows []*testItem
+	if tx = db.Model(&testItem{}).Order("_id", 1).Find(&rows); tx.Error != nil {
+		t.Fatal(tx.Error)
+	}
+	if rows[0].Name != "a" || rows[1].Name != "x" || rows[1].Lv != 2 || rows[2].Name != "x" || rows[2].Lv != 3 {
+		t.Fatalf("Updates result error:%+v,%+v,%+v", rows[0], rows[1], rows[2])
+	}
+}
+
+func TestIncMany(t *testing.T) {
+	dry := New().Session(&Session{DryRun: true})
+	tx := dry.Model(&Role{}).Where("r1").IncMany(map[string]int{"Lv": 1, "exp": 100})
+	want := update.Update{update.UpdateTypeInc: {"lv": 1, "exp": 100}}
+	if r := tx.DryRunResult(); tx.Error != nil || !reflect.DeepEqual(r.Update, want) {
+		t.Fatalf("IncMany error:%v,%+v", tx.Error, r)
+	}
+	//同时 $set 时使用 update.Update
+	up := update.Update{}
+	up.Set("Name", "x")
+	up.Inc("Lv", 1)
+	tx = dry.Model(&testItem{}).Where(1).Update(up)
+	want = update.Update{update.UpdateTypeSet: {"name": "x"}, update.UpdateTypeInc: {"lv": 1}}
+	if r := tx.DryRunResult(); tx.Error != nil || !reflect.DeepEqual(r.Update, want) {
+		t.Fatalf("Update with $set and $inc error:%v,%+v", tx.Error, r)
+	}
+	db := newTestDB(t)
+	resetItems(t, db, testItems()...)
+	if tx = db.Model(&testItem{}).Where(2).IncMany(map[string]int{"Lv": -2}); tx.Error != nil {
+		t.Fatal(tx.Error)
+	}
+	item := &testItem{}
+	if tx = db.Find(item, 2); tx.Error != nil || item.Lv != 0 {
+		t.Fatalf("IncMany decrement error:%v,%+v", tx.Error, item)
+	}
+}
+
+func TestUpdatePrimaryFromValue(t *testing.T) {
+	dry := New().Session(&Session{DryRun: true})
+	tx := dry.Update(&testItem{Id: 1, Name: "x"})
+	if r := tx.DryRunResult(); tx.Error != nil || !reflect.DeepEqual(r.Filter, clause.Filter{"_id": 1}) || !reflect.DeepEqual(r.Update, update.Update{update.UpdateTypeSet: {"name": "x"}}) {
+		t.Fatalf("Update primary from value error:%v,%+v", tx.Error, r)
+	}
+	tx = dry.Model(&testItem{Id: 2}).Update(bson.M{"name": "x"})
+	if r := tx.DryRunResult(); tx.Error != nil || !reflect.DeepEqual(r.Filter, clause.Filter{"_id": 2}) {
+		t.Fatalf("Update primary from model error:%v,%+v", tx.Error, r)
+	}
+	//明确的查询条件优先
+	tx = dry.Update(&testItem{Id: 1, Name: "x"}, "name = ?", "a")
+	if r := tx.DryRunResult(); tx.Error != nil || !reflect.DeepEqual(r.Filter, clause.Filter{"name": "a"}) {
+		t.Fatalf("Update with where error:%v,%+v", tx.Error, r)
+	}
+	if tx = dry.Update(&testItem{Name: "x"}); tx.Error != ErrMissingWhereClause {
+		t.Fatalf("Update without primary error:%v", tx.Error)
+	}
+	//查询不使用 model 中的主键作为条件
+	var rows []*testItem
+	tx = dry.Model(&testItem{Id: 2}).Find(&rows)
+	if r := tx.DryRunResult(); tx.Error != nil || len(r.Filter) != 0 {
+		t.Fatalf("Find with model primary error:%v,%+v", tx.Error, r)
+	}
+	db := newTestDB(t)
+	resetItems(t, db, testItems()...)
+	if tx = db.Update(&testItem{Id: 1, Name: "x"}); tx.Error != nil || tx.RowsAffected != 1 {
+		t.Fatalf("Update primary error:%v,%v", tx.Error, tx.RowsAffected)
+	}
+	item := &testItem{}
+	if tx = db.Find(item, 1); tx.Error != nil || item.Name != "x" || item.Lv != 1 {
+		t.Fatalf("Update primary result error:%v,%+v", tx.Error, item)
+	}
+	rows = nil
+	if tx = db.Model(&testItem{Id: 2}).Find(&rows); tx.Error != nil || len(rows) != 3 {
+		t.Fatalf("Find with model primary error:%v,%v", tx.Error, len(rows))
+	}
+}
@@ -0,0 +1,117 @@
+package cosmo
+
+import "reflect"
+
+// 模型钩子,Create,Update,Delete 时如果 value 或 model 实现了对应接口会自动调用
+// Before 钩子可以修改 value,返回错误时中止操作,错误写入 tx.Error
+// 批量插入时对每个元素分别调用,使用 Session(&Session{SkipHooks: true}) 跳过所有钩子
+
+type BeforeCreateInterface interface {
+	BeforeCreate(tx *DB) error
+}
+
+type AfterCreateInterface interface {
+	AfterCreate(tx *DB) error
+}
+
+type BeforeUpdateInterface interface {
+	BeforeUpdate(tx *DB) error
+}
+
+type AfterUpdateInterface interface {
+	AfterUpdate(tx *DB) error
+}
+
+type BeforeDeleteInterface interface {
+	BeforeDelete(tx *DB) error
+}
+
+type AfterDeleteInterface interface {
+	AfterDelete(tx *DB) error
+}
+
+type hookHandle func(tx *DB, target any) (ok bool, err error)
+
+func hookBeforeCreate(tx *DB, target any) (bool, error) {
+	if i, ok := target.(BeforeCreateInterface); ok {
+		return true, i.BeforeCreate(tx)
+	}
+	return false, nil
+}
+
+func hookAfterCreate(tx *DB, target any) (bool, error) {
+	if i, ok := target.(AfterCreateInterface); ok {
+		return true, i.AfterCreate(tx)
+	}
+	return false, nil
+}
+
+func hookBeforeUpdate(tx *DB, target any) (bool, error) {
+	if i, ok := target.(BeforeUpdateInterface); ok {
+		return true, i.BeforeUpdate(tx)
+	}
+	return false, nil
+}
+
+func hookAfterUpdate(tx *DB, target any) (bool, error) {
+	if i, ok := target.(AfterUpdateInterface); ok {
+		return true, i.AfterUpdate(tx)
+	}
+	return false, nil
+}
+
+func hookBeforeDelete(tx *DB, target any) (bool, error) {
+	if i, ok := target.(BeforeDeleteInterface); ok {
+		return true, i.BeforeDelete(tx)
+	}
+	return false, nil
+}
+
+func hookAfterDelete(tx *DB, target any) (bool, error) {
+	if i, ok := target.(AfterDeleteInterface); ok {
+		return true, i.AfterDelete(tx)
+	}
+	return false, nil
+}
+
+// callHooks 在 value 上调用钩子,value 为 Slice 时对每个元素调用,value 未实现时使用 model
+func callHooks(tx *DB, hook hookHandle) error {
+	if hook == nil || tx.skipHooks {
+		return nil
+	}
+	stmt := tx.statement
+	var called bool
+	for _, target := range hookTargets(stmt.reflectValue) {
+		ok, err := hook(tx, target)
+		if err != nil {
+			return err
+		}
+		called = called || ok
+	}
+	if !called && stmt.model != nil {
+		if _, err := hook(tx, stmt.model); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hookTargets 可以调用钩子的对象,struct 使用指针以便钩子修改数据
+func hookTargets(rv reflect.Value) (r []any) {
+	switch rv.Kind() {
+	case reflect.Struct:
+		if rv.CanAddr() {
+			r = append(r, rv.Addr().Interface())
+		}
+	case reflect.Array, reflect.Slice:
+		for i := 0; i < rv.Len(); i++ {
+			v := rv.Index(i)
+			if v.Kind() == reflect.Ptr && !v.IsNil() {
+				r = append(r, v.Interface())
+			} else if v.Kind() == reflect.Struct && v.CanAddr() {
+				r = append(r, v.Addr().Interface())
+			}
+		}
+	}
+	return
+}
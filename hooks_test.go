@@ -0,0 +1,131 @@
+package cosmo
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+var errHookAbort = errors.New("hook abort")
+
+type testHook struct {
+	Id     int    `bson:"_id"`
+	Status string `bson:"status"`
+}
+
+// BeforeCreate 设置默认值,Status 为 abort 时中止
+func (this *testHook) BeforeCreate(tx *DB) error {
+	switch this.Status {
+	case "":
+		this.Status = "new"
+	case "abort":
+		return errHookAbort
+	}
+	return nil
+}
+
+func TestHooks(t *testing.T) {
+	var executed int
+	p := &processor{handle: func(tx *DB) error {
+		executed++
+		return nil
+	}, before: hookBeforeCreate}
+
+	db := newOfflineDB(t)
+	rows := []*testHook{{Id: 1}, {Id: 2, Status: "old"}}
+	tx := db.getInstance()
+	tx.statement.value = rows
+	if tx = p.Execute(tx); tx.Error != nil {
+		t.Fatal(tx.Error)
+	}
+	if rows[0].Status != "new" || rows[1].Status != "old" || executed != 1 {
+		t.Fatalf("BeforeCreate error:%+v,%+v", rows[0], rows[1])
+	}
+
+	tx = db.getInstance()
+	tx.statement.value = &testHook{Id: 3, Status: "abort"}
+	if tx = p.Execute(tx); !errors.Is(tx.Error, errHookAbort) || executed != 1 {
+		t.Fatalf("BeforeCreate abort error:%v", tx.Error)
+	}
+
+	tx = db.Session(&Session{SkipHooks: true}).getInstance()
+	v := &testHook{Id: 4, Status: "abort"}
+	tx.statement.value = v
+	if tx = p.Execute(tx); tx.Error != nil || executed != 2 {
+		t.Fatalf("SkipHooks error:%v", tx.Error)
+	}
+}
+
+func TestHooksCreate(t *testing.T) {
+	db := newTestDB(t)
+	_, coll := db.Collection(&testHook{})
+	if _, err := coll.DeleteMany(db.statement.Context, map[string]any{}); err != nil {
+		t.Fatal(err)
+	}
+	if tx := db.Create(&testHook{Id: 1}); tx.Error != nil {
+		t.Fatal(tx.Error)
+	}
+	if tx := db.Create(&testHook{Id: 2, Status: "abort"}); !errors.Is(tx.Error, errHookAbort) {
+		t.Fatalf("BeforeCreate abort error:%v", tx.Error)
+	}
+	var rows []*testHook
+	if tx := db.Find(&rows); tx.Error != nil {
+		t.Fatal(tx.Error)
+	}
+	if len(rows) != 1 || rows[0].Status != "new" {
+		t.Fatalf("hooks create result error:%v", rows)
+	}
+}
+
+type testCounterPlugin struct {
+	creates int
+	order   []string
+}
+
+func (p *testCounterPlugin) Name() string {
+	return "counter"
+}
+
+func (p *testCounterPlugin) Initialize(db *DB) error {
+	return db.Callback().Register(CallbackCreate, func(tx *DB, next func() error) error {
+		p.creates++
+		p.order = append(p.order, "around")
+		return next()
+	})
+}
+
+func TestPlugin(t *testing.T) {
+	db := newOfflineDB(t)
+	plugin := &testCounterPlugin{}
+	if err := db.Use(plugin); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Use(plugin); err != ErrRegistered {
+		t.Fatalf("Use duplicate plugin error:%v", err)
+	}
+	if err := db.Callback().Register("unknown", nil); err == nil {
+		t.Fatalf("Register unknown processor should fail")
+	}
+	if err := db.Callback().Replace(CallbackCreate, func(tx *DB) error {
+		plugin.order = append(plugin.order, "create")
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 2; i++ {
+		if tx := db.Create(&testHook{Id: i}); tx.Error != nil {
+			t.Fatal(tx.Error)
+		}
+	}
+	if plugin.creates != 2 || !reflect.DeepEqual(plugin.order, []string{"around", "create", "around", "create"}) {
+		t.Fatalf("plugin around error:%v,%v", plugin.creates, plugin.order)
+	}
+	//不调用 next 时中止操作
+	errAbort := errors.New("abort")
+	_ = db.Callback().Register(CallbackCreate, func(tx *DB, next func() error) error {
+		return errAbort
+	})
+	if tx := db.Create(&testHook{Id: 3}); tx.Error != errAbort || plugin.creates != 3 || len(plugin.order) != 5 {
+		t.Fatalf("plugin abort error:%v,%v", tx.Error, plugin.order)
+	}
+}
@@ -0,0 +1,176 @@
+package cosmo
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/hwcer/cosgo/schema"
+	"github.com/hwcer/cosmo/clause"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// 索引标签中 cosmo 扩展的设置,与 name,sort,unique,sparse 等写在同一个 index 标签中
+//
+//	Name   string    `bson:"name" index:"unique"`
+//	Email  string    `bson:"email" index:"unique,sparse"`
+//	Expire time.Time `bson:"expire" index:"ttl:3600"`
+//	User   string    `bson:"user" index:"unique,collation:en:2"`
+//	Code   string    `bson:"code" index:"unique,where:status = active & lv > 1"`
+const (
+	IndexTTL       = "TTL"       //过期时间(秒),文档在字段时间之后 ttl 秒自动删除
+	IndexCollation = "COLLATION" //字符串比较规则 locale:strength,strength 为2时忽略大小写
+	IndexWhere     = "WHERE"     //部分索引条件 field op value,多个条件使用 & 连接,同时满足时建立索引
+)
+
+// indexWhereSplit 部分索引多个条件之间的分隔符
+const indexWhereSplit = "&"
+
+// indexModel 生成索引,在 schema.Index.Build 的基础上增加 cosmo 扩展的索引选项
+func indexModel(sch *schema.Schema, index *schema.Index) (model mongo.IndexModel, err error) {
+	model = index.Build()
+	settings := indexSettings(sch, index)
+	if v, ok := settings[IndexTTL]; ok {
+		var ttl int
+		if ttl, err = strconv.Atoi(v); err != nil || ttl < 0 {
+			return model, fmt.Errorf("index %v ttl invalid:%v", index.Name, v)
+		}
+		if len(index.Fields) != 1 {
+			return model, fmt.Errorf("index %v ttl only supports single field index", index.Name)
+		}
+		if field := sch.LookUpField(index.Fields[0].GetDBName()); field == nil || !isTimeField(field) {
+			return model, fmt.Errorf("index %v ttl only supports time.Time field", index.Name)
+		}
+		model.Options.SetExpireAfterSeconds(int32(ttl))
+	}
+	if v, ok := settings[IndexCollation]; ok {
+		var c *options.Collation
+		if c, err = indexCollation(v); err != nil {
+			return model, fmt.Errorf("index %v collation invalid:%v", index.Name, v)
+		}
+		model.Options.SetCollation(c)
+	}
+	if v, ok := settings[IndexWhere]; ok {
+		var filter clause.Filter
+		if filter, err = indexWhere(sch, v); err != nil {
+			return model, fmt.Errorf("index %v where invalid:%v,%w", index.Name, v, err)
+		}
+		model.Options.SetPartialFilterExpression(filter)
+	}
+	return
+}
+
+// indexWhereOperators 部分索引条件支持的运算符
+var indexWhereOperators = map[string]bool{"=": true, ">": true, ">=": true, "<": true, "<=": true}
+
+// indexWhere 使用 clause.Query 生成部分索引条件,字段名使用模型字段名或数据库字段名
+func indexWhere(sch *schema.Schema, v string) (clause.Filter, error) {
+	q := clause.New()
+	for _, s := range strings.Split(v, indexWhereSplit) {
+		s = strings.TrimSpace(s)
+		i := strings.IndexAny(s, "<>=!")
+		if i <= 0 {
+			return nil, ErrInvalidValue
+		}
+		op := s[i : i+1]
+		if i+1 < len(s) && (s[i+1] == '=' || s[i] == '<' && s[i+1] == '>') {
+			op = s[i : i+2]
+		}
+		//部分索引不支持 $ne,$nin
+		if !indexWhereOperators[op] {
+			return nil, ErrInvalidValue
+		}
+		key, value := strings.TrimSpace(s[:i]), strings.TrimSpace(s[i+len(op):])
+		if value == "" {
+			return nil, ErrInvalidValue
+		}
+		q.Where(key+" "+op+" ?", indexWhereValue(value))
+	}
+	if err := q.Err(); err != nil {
+		return nil, err
+	}
+	return q.Build(sch), nil
+}
+
+// indexWhereValue 条件中的值,数字和布尔值转换成对应类型,使用引号时作为字符串
+func indexWhereValue(s string) any {
+	if n := len(s); n >= 2 && (s[0] == '"' || s[0] == '\'') && s[n-1] == s[0] {
+		return s[1 : n-1]
+	}
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return i
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f
+	}
+	if b, err := strconv.ParseBool(s); err == nil {
+		return b
+	}
+	return s
+}
+
+// indexCollation 解析 locale:strength 格式的 collation
+func indexCollation(v string) (*options.Collation, error) {
+	arr := strings.Split(v, ":")
+	if arr[0] == "" || len(arr) > 2 {
+		return nil, ErrInvalidValue
+	}
+	c := &options.Collation{Locale: arr[0]}
+	if len(arr) == 2 {
+		strength, err := strconv.Atoi(arr[1])
+		if err != nil || strength < 1 || strength > 5 {
+			return nil, ErrInvalidValue
+		}
+		c.Strength = strength
+	}
+	return c, nil
+}
+
+// indexSettings 索引标签设置,组合索引中多个字段的设置合并
+func indexSettings(sch *schema.Schema, index *schema.Index) map[string]string {
+	r := map[string]string{}
+	for _, f := range index.Fields {
+		field := sch.LookUpField(f.GetDBName())
+		if field == nil {
+			continue
+		}
+		tag, ok := field.StructField.Tag.Lookup(schema.IndexTag)
+		if !ok {
+			continue
+		}
+		for _, value := range strings.Split(tag, ";") {
+			if value == "" {
+				continue
+			}
+			settings := schema.ParseTagSetting(value, ",")
+			name := settings[schema.IndexName]
+			if name == "" {
+				name = strings.Join([]string{"", "idx", sch.Table, field.DBName}, "_")
+			}
+			if name != index.Name {
+				continue
+			}
+			for k, v := range settings {
+				//组合索引中多个字段的条件同时生效
+				if k == IndexWhere && r[k] != "" {
+					v = r[k] + indexWhereSplit + v
+				}
+				r[k] = v
+			}
+		}
+	}
+	return r
+}
+
+func isTimeField(field *schema.Field) bool {
+	t := field.IndirectFieldType
+	if t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		t = t.Elem()
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t == timeType
+}
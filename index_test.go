@@ -0,0 +1,167 @@
+package cosmo
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hwcer/cosgo/schema"
+	"github.com/hwcer/cosmo/clause"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type testTTLIndex struct {
+	Id      int       `bson:"_id"`
+	Expire  time.Time `bson:"expire" index:"ttl:3600"`
+	Name    string    `bson:"name" index:"name:idx_name_lv"`
+	Lv      int       `bson:"lv" index:"name:idx_name_lv,ttl:60"`
+	Created int64     `bson:"created" index:"ttl:60"`
+}
+
+// testIndex 查找包含字段 field 的索引
+func testIndex(t *testing.T, model any, field string) (*schema.Schema, *schema.Index) {
+	sch, err := schema.Parse(model)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, index := range sch.ParseIndexes() {
+		for _, f := range index.Fields {
+			if f.GetDBName() == field {
+				return sch, index
+			}
+		}
+	}
+	t.Fatalf("index on %v not found", field)
+	return nil, nil
+}
+
+func TestIndexTTL(t *testing.T) {
+	sch, index := testIndex(t, &testTTLIndex{}, "expire")
+	im, err := indexModel(sch, index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if im.Options.ExpireAfterSeconds == nil || *im.Options.ExpireAfterSeconds != 3600 {
+		t.Fatalf("ttl index ExpireAfterSeconds error:%v", im.Options.ExpireAfterSeconds)
+	}
+	//组合索引和非时间字段不能使用 TTL
+	for _, field := range []string{"lv", "created"} {
+		sch, index = testIndex(t, &testTTLIndex{}, field)
+		if _, err = indexModel(sch, index); err == nil {
+			t.Fatalf("index %v ttl should return error", index.Name)
+		}
+	}
+}
+
+type testUniqueIndex struct {
+	Id    int    `bson:"_id"`
+	Name  string `bson:"name" index:"unique"`
+	Email string `bson:"email" index:"unique,sparse"`
+	Lv    int    `bson:"lv" index:""`
+}
+
+func TestIndexUnique(t *testing.T) {
+	cases := map[string][2]bool{"name": {true, false}, "email": {true, true}, "lv": {false, false}}
+	for field, want := range cases {
+		sch, index := testIndex(t, &testUniqueIndex{}, field)
+		im, err := indexModel(sch, index)
+		if err != nil {
+			t.Fatal(err)
+		}
+		unique := im.Options.Unique != nil && *im.Options.Unique
+		sparse := im.Options.Sparse != nil && *im.Options.Sparse
+		if unique != want[0] || sparse != want[1] {
+			t.Fatalf("index %v unique=%v sparse=%v, want %v", field, unique, sparse, want)
+		}
+	}
+	err := indexError("idx", mongo.CommandError{Code: 11000, Message: "E11000 duplicate key error"})
+	if !errors.Is(err, ErrIndexDuplicate) {
+		t.Fatalf("duplicate index error:%v", err)
+	}
+	if err = indexError("idx", nil); err != nil {
+		t.Fatalf("nil index error:%v", err)
+	}
+}
+
+func TestIndexDuplicate(t *testing.T) {
+	db := newTestDB(t)
+	_, coll := db.Collection(&testUniqueIndex{})
+	_ = coll.Drop(db.statement.Context)
+	if _, err := coll.InsertMany(db.statement.Context, []any{&testUniqueIndex{Id: 1, Name: "a"}, &testUniqueIndex{Id: 2, Name: "a"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrator(&testUniqueIndex{}); !errors.Is(err, ErrIndexDuplicate) {
+		t.Fatalf("AutoMigrator with duplicate data error:%v", err)
+	}
+}
+
+type testCollationIndex struct {
+	Id   int    `bson:"_id"`
+	User string `bson:"user" index:"unique,collation:en:2"`
+	Code string `bson:"code" index:"collation:fr"`
+	Bad  string `bson:"bad" index:"collation:en:9"`
+}
+
+func TestIndexCollation(t *testing.T) {
+	cases := map[string]*options.Collation{
+		"user": {Locale: "en", Strength: 2},
+		"code": {Locale: "fr"},
+	}
+	for field, want := range cases {
+		sch, index := testIndex(t, &testCollationIndex{}, field)
+		im, err := indexModel(sch, index)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(im.Options.Collation, want) {
+			t.Fatalf("index %v collation = %+v, want %+v", field, im.Options.Collation, want)
+		}
+	}
+	sch, index := testIndex(t, &testCollationIndex{}, "bad")
+	if _, err := indexModel(sch, index); err == nil {
+		t.Fatalf("invalid collation strength should return error")
+	}
+}
+
+type testPartialIndex struct {
+	Id     int    `bson:"_id"`
+	Code   string `bson:"code" index:"unique,where:Status = active & lv > 1"`
+	Status string `bson:"status"`
+	Lv     int    `bson:"lv"`
+	Name   string `bson:"name" index:"name:idx_name_group,where:deleted = false"`
+	Group  string `bson:"group" index:"name:idx_name_group,where:lv >= '2'"`
+	Email  string `bson:"email" index:"where:status"`
+}
+
+func TestIndexPartial(t *testing.T) {
+	sch, index := testIndex(t, &testPartialIndex{}, "code")
+	im, err := indexModel(sch, index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := clause.Filter{"status": "active", "lv": bson.M{"$gt": int64(1)}}
+	if !reflect.DeepEqual(im.Options.PartialFilterExpression, want) || im.Options.Unique == nil || !*im.Options.Unique {
+		t.Fatalf("partial index filter = %v, want %v", im.Options.PartialFilterExpression, want)
+	}
+	//组合索引中多个字段的条件合并
+	sch, index = testIndex(t, &testPartialIndex{}, "group")
+	if im, err = indexModel(sch, index); err != nil {
+		t.Fatal(err)
+	}
+	want = clause.Filter{"deleted": false, "lv": bson.M{"$gte": "2"}}
+	if !reflect.DeepEqual(im.Options.PartialFilterExpression, want) {
+		t.Fatalf("compound partial index filter = %v, want %v", im.Options.PartialFilterExpression, want)
+	}
+	sch, index = testIndex(t, &testPartialIndex{}, "email")
+	if _, err = indexModel(sch, index); err == nil {
+		t.Fatalf("partial index without operator should return error")
+	}
+	for _, v := range []string{"lv != 1", "lv <> 1", "lv ! 1", "lv > 1 & status != active"} {
+		if _, err = indexWhere(sch, v); !errors.Is(err, ErrInvalidValue) {
+			t.Fatalf("indexWhere(%q) err = %v, want ErrInvalidValue", v, err)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package cosmo
+
+import "time"
+
+// logExecute 使用 Session.Logger 记录执行的操作
+// 出错时使用 Error,执行时间超过 SlowThreshold 时使用 Alert,其他使用 Debug
+func logExecute(tx *DB, name string, elapsed time.Duration, err error) {
+	stmt := tx.statement
+	if name == "" {
+		name = "call"
+	}
+	const format = "cosmo %v table=%v filter=%v update=%v rows=%v duration=%v"
+	args := []any{name, stmt.table, stmt.Clause.Build(stmt.schema), stmt.update, tx.RowsAffected, elapsed}
+	switch {
+	case err != nil:
+		tx.logger.Error(format+" error=%v", append(args, err)...)
+	case tx.slowTime > 0 && elapsed >= tx.slowTime:
+		tx.logger.Alert("slow "+format, args...)
+	default:
+		tx.logger.Debug(format, args...)
+	}
+}
@@ -0,0 +1,70 @@
+package cosmo
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testLogger struct {
+	entries []string
+}
+
+func (l *testLogger) log(level string, format any, args ...any) {
+	l.entries = append(l.entries, level+" "+fmt.Sprintf(fmt.Sprint(format), args...))
+}
+
+func (l *testLogger) Fatal(format any, args ...any) { l.log("fatal", format, args...) }
+func (l *testLogger) Panic(format any, args ...any) { l.log("panic", format, args...) }
+func (l *testLogger) Error(format any, args ...any) { l.log("error", format, args...) }
+func (l *testLogger) Alert(format any, args ...any) { l.log("alert", format, args...) }
+func (l *testLogger) Trace(format any, args ...any) { l.log("trace", format, args...) }
+func (l *testLogger) Debug(format any, args ...any) { l.log("debug", format, args...) }
+
+func TestLogger(t *testing.T) {
+	db := newOfflineDB(t)
+	errQuery := errors.New("query failed")
+	var slow bool
+	_ = db.Callback().Replace(CallbackCreate, func(tx *DB) error {
+		tx.RowsAffected = 1
+		return nil
+	})
+	_ = db.Callback().Replace(CallbackQuery, func(tx *DB) error {
+		if slow {
+			time.Sleep(5 * time.Millisecond)
+			return nil
+		}
+		return errQuery
+	})
+	log := &testLogger{}
+	tx := db.Session(&Session{Logger: log, SlowThreshold: time.Millisecond})
+	if r := tx.Create(&testItem{Id: 1}); r.Error != nil {
+		t.Fatal(r.Error)
+	}
+	var rows []*testItem
+	if r := tx.Model(&testItem{}).Find(&rows, "status = ?", "active"); r.Error != errQuery {
+		t.Fatalf("query error:%v", r.Error)
+	}
+	slow = true
+	if r := tx.Model(&testItem{}).Find(&rows); r.Error != nil {
+		t.Fatal(r.Error)
+	}
+	if len(log.entries) != 3 {
+		t.Fatalf("logger entries error:%v", log.entries)
+	}
+	if e := log.entries[0]; !strings.HasPrefix(e, "debug cosmo create table=") || !strings.Contains(e, "rows=1") {
+		t.Fatalf("create log error:%v", e)
+	}
+	if e := log.entries[1]; !strings.HasPrefix(e, "error cosmo query") || !strings.Contains(e, `filter={"status":"active"}`) || !strings.Contains(e, "error=query failed") {
+		t.Fatalf("query log error:%v", e)
+	}
+	if e := log.entries[2]; !strings.HasPrefix(e, "alert slow cosmo query") {
+		t.Fatalf("slow query log error:%v", e)
+	}
+	//没有设置 Logger 时不记录
+	if r := db.Create(&testItem{Id: 2}); r.Error != nil || len(log.entries) != 3 {
+		t.Fatalf("logger without session error:%v", log.entries)
+	}
+}
@@ -4,37 +4,179 @@ import (
 	"context"
 	"fmt"
 	"github.com/hwcer/cosgo/schema"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"sort"
 	"strings"
 )
 
+// IndexMigrationResult AutoMigratorReport 中每个索引的处理结果
+type IndexMigrationResult struct {
+	Table   string
+	Name    string
+	Created bool  //本次新建,false 表示索引已经存在
+	Err     error //创建失败的原因
+}
+
 // AutoMigrator returns migrator
 // Sparse
 func (db *DB) AutoMigrator(dst ...interface{}) error {
+	_, err := db.AutoMigratorReport(dst...)
+	return err
+}
+
+// AutoMigratorReport 同 AutoMigrator,返回每个索引是新建还是已经存在,遇到错误时停止
+func (db *DB) AutoMigratorReport(dst ...interface{}) (report []IndexMigrationResult, err error) {
+	for _, mod := range dst {
+		var sch *schema.Schema
+		if sch, err = schema.Parse(mod); err != nil {
+			return
+		}
+		indexes := sch.ParseIndexes()
+		if len(indexes) == 0 {
+			continue
+		}
+		tx, coll := db.Collection(mod)
+		if tx.Error != nil {
+			return report, tx.Error
+		}
+		var specs []bson.M
+		if specs, err = listIndexes(tx.statement.Context, coll); err != nil {
+			return
+		}
+		exist := map[string]bool{}
+		for _, spec := range specs {
+			if name, ok := spec["name"].(string); ok {
+				exist[name] = true
+			}
+		}
+		names := make([]string, 0, len(indexes))
+		for name := range indexes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			created, e := db.indexes(coll, indexes[name], sch)
+			report = append(report, IndexMigrationResult{Table: sch.Table, Name: name, Created: created && !exist[name], Err: e})
+			if e != nil {
+				return report, fmt.Errorf("AutoMigrator[%v.%v]:%w", db.dbname, sch.Table, e)
+			}
+		}
+	}
+	return
+}
+
+// indexes 创建索引,索引已经存在时 created=false
+func (db *DB) indexes(coll *mongo.Collection, index *schema.Index, sch *schema.Schema) (created bool, err error) {
+	var im mongo.IndexModel
+	if im, err = indexModel(sch, index); err != nil {
+		return
+	}
+	indexView := coll.Indexes()
+	_, err = indexView.CreateOne(context.Background(), im)
+	cv, ok := err.(mongo.CommandError)
+	if ok && cv.Code == 85 && im.Options.ExpireAfterSeconds != nil {
+		//TTL 修改过期时间
+		return false, db.indexTTL(coll, index.Name, *im.Options.ExpireAfterSeconds)
+	}
+	if ok && cv.Code == 85 && im.Options.Collation != nil {
+		//collation 不同时不能复用已有索引,需要手动删除后重建
+		return false, fmt.Errorf("index %v already exists with different options,drop it to apply collation:%w", index.Name, err)
+	}
+	if ok && cv.Code == 85 || strings.HasPrefix(cv.Message, "Index already exists with a different name") {
+		return false, nil
+	}
+	return err == nil, indexError(index.Name, err)
+}
+
+// listIndexes 集合中已有的索引
+func listIndexes(ctx context.Context, coll *mongo.Collection) (specs []bson.M, err error) {
+	cursor, err := coll.Indexes().List(ctx)
+	if err != nil {
+		return
+	}
+	err = cursor.All(ctx, &specs)
+	return
+}
+
+// indexError 唯一索引因为已有重复数据创建失败时返回 ErrIndexDuplicate
+func indexError(name string, err error) error {
+	if err != nil && mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("%w: index %v,%v", ErrIndexDuplicate, name, err)
+	}
+	return err
+}
+
+// indexTTL 修改已经存在的 TTL 索引过期时间
+func (db *DB) indexTTL(coll *mongo.Collection, name string, ttl int32) error {
+	cmd := bson.D{
+		{Key: "collMod", Value: coll.Name()},
+		{Key: "index", Value: bson.D{{Key: "name", Value: name}, {Key: "expireAfterSeconds", Value: ttl}}},
+	}
+	return coll.Database().RunCommand(context.Background(), cmd).Err()
+}
+
+// ModelIndexKeep 模型实现此接口时,AutoMigratorSync 保留返回的索引,用于在 cosmo 之外创建的索引
+type ModelIndexKeep interface {
+	IndexKeep() []string
+}
+
+// AutoMigratorSync 创建模型中定义的索引,同时删除集合中模型没有定义的索引
+// 不会删除 _id 索引,正在创建中的索引以及 ModelIndexKeep 返回的索引
+func (db *DB) AutoMigratorSync(dst ...interface{}) error {
+	if err := db.AutoMigrator(dst...); err != nil {
+		return err
+	}
 	for _, mod := range dst {
 		sch, err := schema.Parse(mod)
 		if err != nil {
 			return err
 		}
-		indexes := sch.ParseIndexes()
-		for _, index := range indexes {
-			if e := db.indexes(mod, index); e != nil {
-				return fmt.Errorf("AutoMigrator[%v.%v]:%v", db.dbname, sch.Table, e)
-			}
+		if err = db.indexSync(mod, sch); err != nil {
+			return fmt.Errorf("AutoMigratorSync[%v.%v]:%w", db.dbname, sch.Table, err)
 		}
 	}
 	return nil
 }
 
-func (db *DB) indexes(model interface{}, index *schema.Index) (err error) {
+func (db *DB) indexSync(model interface{}, sch *schema.Schema) error {
 	tx, coll := db.Collection(model)
 	if tx.Error != nil {
 		return tx.Error
 	}
-	indexView := coll.Indexes()
-	_, err = indexView.CreateOne(context.Background(), index.Build())
-	if cv, ok := err.(mongo.CommandError); ok && cv.Code == 85 || strings.HasPrefix(cv.Message, "Index already exists with a different name") {
-		err = nil
+	keep := map[string]bool{}
+	for name := range sch.ParseIndexes() {
+		keep[name] = true
+	}
+	if k, ok := model.(ModelIndexKeep); ok {
+		for _, name := range k.IndexKeep() {
+			keep[name] = true
+		}
+	}
+	ctx := tx.statement.Context
+	specs, err := listIndexes(ctx, coll)
+	if err != nil {
+		return err
+	}
+	for _, name := range obsoleteIndexes(specs, keep) {
+		if _, err = coll.Indexes().DropOne(ctx, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// obsoleteIndexes 需要删除的索引名称
+func obsoleteIndexes(specs []bson.M, keep map[string]bool) (r []string) {
+	for _, spec := range specs {
+		name, _ := spec["name"].(string)
+		if name == "" || name == "_id_" || keep[name] {
+			continue
+		}
+		if _, building := spec["buildUUID"]; building {
+			continue
+		}
+		r = append(r, name)
 	}
 	return
 }
@@ -0,0 +1,89 @@
+package cosmo
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/hwcer/cosgo/schema"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type testSyncIndex struct {
+	Id   int    `bson:"_id"`
+	Name string `bson:"name" index:"name:idx_sync_name"`
+	Lv   int    `bson:"lv"`
+}
+
+func (testSyncIndex) IndexKeep() []string {
+	return []string{"idx_sync_keep"}
+}
+
+func TestObsoleteIndexes(t *testing.T) {
+	specs := []bson.M{
+		{"name": "_id_"},
+		{"name": "idx_sync_name"},
+		{"name": "idx_sync_keep"},
+		{"name": "idx_sync_old"},
+		{"name": "idx_sync_building", "buildUUID": "x"},
+	}
+	keep := map[string]bool{"idx_sync_name": true, "idx_sync_keep": true}
+	if r := obsoleteIndexes(specs, keep); !reflect.DeepEqual(r, []string{"idx_sync_old"}) {
+		t.Fatalf("obsoleteIndexes error:%v", r)
+	}
+}
+
+func TestAutoMigratorSync(t *testing.T) {
+	db := newTestDB(t)
+	_, coll := db.Collection(&testSyncIndex{})
+	_ = coll.Drop(db.statement.Context)
+	indexes := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "lv", Value: 1}}, Options: options.Index().SetName("idx_sync_old")},
+		{Keys: bson.D{{Key: "lv", Value: -1}}, Options: options.Index().SetName("idx_sync_keep")},
+	}
+	if _, err := coll.Indexes().CreateMany(db.statement.Context, indexes); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigratorSync(&testSyncIndex{}); err != nil {
+		t.Fatal(err)
+	}
+	cursor, err := coll.Indexes().List(db.statement.Context)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var specs []bson.M
+	if err = cursor.All(db.statement.Context, &specs); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, spec := range specs {
+		names = append(names, spec["name"].(string))
+	}
+	sort.Strings(names)
+	if want := []string{"_id_", "idx_sync_keep", "idx_sync_name"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("AutoMigratorSync indexes = %v, want %v", names, want)
+	}
+}
+
+func TestAutoMigratorReport(t *testing.T) {
+	db := newTestDB(t)
+	_, coll := db.Collection(&testSyncIndex{})
+	_ = coll.Drop(db.statement.Context)
+	sch, err := schema.Parse(&testSyncIndex{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []IndexMigrationResult{{Table: sch.Table, Name: "idx_sync_name", Created: true}}
+	for i := 0; i < 2; i++ {
+		report, err := db.AutoMigratorReport(&testSyncIndex{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(report, want) {
+			t.Fatalf("AutoMigratorReport #%d = %+v, want %+v", i, report, want)
+		}
+		want[0].Created = false
+	}
+}
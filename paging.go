@@ -8,8 +8,6 @@ import (
 // Paging 分页
 type Paging struct {
 	order []bson.E //排序
-	//limit  int      //每页大小
-	//offset int      //当前页
 
 	Rows   interface{} `json:"rows"`
 	Page   int         `json:"page"`   //当前页
@@ -28,15 +26,26 @@ func (this *Paging) Init(size int) {
 	}
 }
 
+// Result 根据总记录数计算总页数,Size 未设置时使用 DefaultPageSize
+// Page 限制在 [1,Total] 之间,没有记录时为1
 func (this *Paging) Result(r int) {
-	if this.Size == 0 {
-		this.Init(100)
+	if this.Size <= 0 {
+		this.Size = DefaultPageSize
+	}
+	if r < 0 {
+		r = 0
 	}
 	this.Record = r
 	this.Total = r / this.Size
 	if r%this.Size != 0 {
 		this.Total += 1
 	}
+	if this.Page > this.Total {
+		this.Page = this.Total
+	}
+	if this.Page < 1 {
+		this.Page = 1
+	}
 }
 
 func (this *Paging) Offset() int {
@@ -44,17 +53,20 @@ func (this *Paging) Offset() int {
 }
 
 // Order 排序方式 1 和 -1 来指定排序的方式，其中 1 为升序排列，而 -1 是用于降序排列。
+// Page 查询时与链式调用 db.Order 设置的排序合并,Paging 中的排序优先
 func (this *Paging) Order(key string, sort int) {
-	if sort > 0 {
-		sort = 1
-	} else {
-		sort = -1
-	}
 	this.order = append(this.order, bson.E{
-		Key: key, Value: sort,
+		Key: key, Value: sortValue(sort),
 	})
 }
 
+func sortValue(sort int) int {
+	if sort > 0 {
+		return 1
+	}
+	return -1
+}
+
 // Options 转换成FindOptions
 func (this *Paging) Options() *options.FindOptions {
 	opts := options.Find()
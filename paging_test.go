@@ -0,0 +1,99 @@
+package cosmo
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hwcer/cosmo/clause"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestPagingResult(t *testing.T) {
+	cases := []struct {
+		paging            Paging
+		record            int
+		page, size, total int
+	}{
+		{Paging{}, 0, 1, DefaultPageSize, 0},
+		{Paging{}, 250, 1, DefaultPageSize, 3},
+		{Paging{Size: -1, Page: -2}, 10, 1, DefaultPageSize, 1},
+		{Paging{Size: 50, Page: 2}, 10, 1, 50, 1},
+		{Paging{Size: 3, Page: 9}, 10, 4, 3, 4},
+		{Paging{Size: 5, Page: 2}, 10, 2, 5, 2},
+		{Paging{Size: 5, Page: 2}, -1, 1, 5, 0},
+	}
+	for i, c := range cases {
+		p := c.paging
+		p.Result(c.record)
+		if p.Page != c.page || p.Size != c.size || p.Total != c.total {
+			t.Fatalf("case %d Result(%d) page=%d size=%d total=%d, want %d,%d,%d", i, c.record, p.Page, p.Size, p.Total, c.page, c.size, c.total)
+		}
+	}
+}
+
+func TestPagingOrder(t *testing.T) {
+	paging := &Paging{}
+	paging.Order("Lv", -5)
+	tx := New().Model(&testItem{}).Order("Name", 1)
+	tx.statement.Paging = paging
+	if tx = tx.statement.Parse(); tx.Error != nil {
+		t.Fatal(tx.Error)
+	}
+	want := bson.D{{Key: "lv", Value: -1}, {Key: "name", Value: 1}}
+	if order := tx.statement.Order(); !reflect.DeepEqual(order, want) {
+		t.Fatalf("paging order = %v, want %v", order, want)
+	}
+	if opts := paging.Options(); !reflect.DeepEqual(opts.Sort, []bson.E{{Key: "Lv", Value: -1}}) {
+		t.Fatalf("Paging.Options sort error:%v", opts.Sort)
+	}
+}
+
+type testPageUpdate struct {
+	Id     int   `bson:"_id"`
+	Lv     int   `bson:"lv"`
+	Update int64 `bson:"update"`
+}
+
+func TestPageUpdateOrder(t *testing.T) {
+	paging := &Paging{Update: 100}
+	paging.Order("Lv", 1)
+	tx := New().Model(&testPageUpdate{}).Order("_id", 1)
+	tx.statement.Paging = paging
+	if tx = tx.statement.Parse(); tx.Error != nil {
+		t.Fatal(tx.Error)
+	}
+	if err := pageUpdate(tx.statement); err != nil {
+		t.Fatal(err)
+	}
+	want := bson.D{{Key: "update", Value: -1}, {Key: "lv", Value: 1}, {Key: "_id", Value: 1}}
+	if order := tx.statement.Order(); !reflect.DeepEqual(order, want) {
+		t.Fatalf("paging update order = %v, want %v", order, want)
+	}
+	if filter := tx.statement.Filter(); !reflect.DeepEqual(filter, clause.Filter{"update": bson.M{"$gt": int64(100)}}) {
+		t.Fatalf("paging update filter error:%v", filter)
+	}
+}
+
+func TestPageOrder(t *testing.T) {
+	db := newTestDB(t)
+	resetItems(t, db, testItems()...)
+	paging := &Paging{Size: 2}
+	paging.Order("Lv", -1)
+	var rows []*testItem
+	paging.Rows = &rows
+	if tx := db.Model(&testItem{}).Page(paging); tx.Error != nil {
+		t.Fatal(tx.Error)
+	}
+	if len(rows) != 2 || rows[0].Id != 3 || rows[1].Id != 2 || paging.Record != 3 || paging.Total != 2 {
+		t.Fatalf("Page order error:%+v", paging)
+	}
+	//链式调用的排序在 Paging 排序之后
+	rows = nil
+	paging = &Paging{Size: 2, Rows: &rows}
+	if tx := db.Model(&testItem{}).Order("Status", -1).Order("_id", 1).Page(paging); tx.Error != nil {
+		t.Fatal(tx.Error)
+	}
+	if len(rows) != 2 || rows[0].Id != 3 || rows[1].Id != 1 {
+		t.Fatalf("Page chained order error:%v", len(rows))
+	}
+}
@@ -0,0 +1,64 @@
+package cosmo
+
+import (
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Pipeline 聚合管道
+//
+//	pipeline := cosmo.Pipeline{}.Match(bson.M{"lv": bson.M{"$gt": 1}}).Group(bson.M{"_id": "$name", "count": bson.M{"$sum": 1}})
+type Pipeline []bson.D
+
+// Stage 添加任意阶段,name 可以省略 $ 前缀
+// name 为空时保留空的阶段名,Aggregate 时返回 ErrInvalidPipeline
+func (p Pipeline) Stage(name string, v any) Pipeline {
+	if name != "" && !strings.HasPrefix(name, "$") {
+		name = "$" + name
+	}
+	return append(p, bson.D{{Key: name, Value: v}})
+}
+
+// Err 检查每个阶段有且只有一个以 $ 开头的阶段名
+func (p Pipeline) Err() error {
+	for i, stage := range p {
+		if len(stage) != 1 || len(stage[0].Key) < 2 || !strings.HasPrefix(stage[0].Key, "$") {
+			return fmt.Errorf("%w: stage %d %v", ErrInvalidPipeline, i, stage)
+		}
+	}
+	return nil
+}
+
+func (p Pipeline) Match(filter any) Pipeline {
+	return p.Stage("$match", filter)
+}
+
+func (p Pipeline) Group(v any) Pipeline {
+	return p.Stage("$group", v)
+}
+
+func (p Pipeline) Project(v any) Pipeline {
+	return p.Stage("$project", v)
+}
+
+func (p Pipeline) Sort(v any) Pipeline {
+	return p.Stage("$sort", v)
+}
+
+func (p Pipeline) Skip(n int64) Pipeline {
+	return p.Stage("$skip", n)
+}
+
+func (p Pipeline) Limit(n int64) Pipeline {
+	return p.Stage("$limit", n)
+}
+
+func (p Pipeline) Unwind(path string) Pipeline {
+	return p.Stage("$unwind", path)
+}
+
+func (p Pipeline) Count(field string) Pipeline {
+	return p.Stage("$count", field)
+}
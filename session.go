@@ -2,22 +2,26 @@ package cosmo
 
 import (
 	"context"
+	"time"
+
+	"github.com/hwcer/cosgo/logger"
 )
 
 // Session session config when create session with Session() method
 type Session struct {
 	DBName string
-	//DryRun                   bool
+	DryRun bool //只生成查询条件和更新内容,不执行,使用 DryRunResult 获取
 	//PrepareStmt              bool
 	//NewDB     bool
-	//SkipHooks bool
+	SkipHooks bool //不执行 BeforeCreate,AfterUpdate 等模型钩子
 	//SkipDefaultTransaction   bool
 	//DisableNestedTransaction bool
 	//AllowGlobalUpdate        bool
 	//FullSaveAssociations     bool
 	//QueryFields              bool
-	Context context.Context
-	//Logger  logger.Interface
-	//NowTime func() time.Time
+	Context       context.Context
+	Logger        logger.Interface //记录执行的操作,为nil时不记录
+	SlowThreshold time.Duration    //执行时间超过时使用 Alert 记录慢查询,0 不区分
+	NowTime       func() time.Time //自动时间戳和软删除使用的时钟,为nil时使用 time.Now
 	//CreateBatchSize          int
 }
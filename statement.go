@@ -3,21 +3,29 @@ package cosmo
 import (
 	"context"
 	"reflect"
+	"time"
 
 	"github.com/hwcer/cosgo/schema"
 	"github.com/hwcer/cosmo/clause"
 	"github.com/hwcer/cosmo/update"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
 )
 
 func NewStatement(db *DB) *Statement {
-	return &Statement{
-		DB:      db,
-		Context: context.Background(),
-		Clause:  clause.New(),
-		Paging:  &Paging{},
+	stmt := &Statement{
+		DB:             db,
+		Context:        context.Background(),
+		Clause:         clause.New(),
+		Paging:         &Paging{},
+		returnDocument: options.After,
 		//settings: map[string]interface{}{},
 	}
+	stmt.Clause.Alias(db.FieldAlias)
+	return stmt
 }
 
 // Statement statement
@@ -32,9 +40,28 @@ type Statement struct {
 	Clause               *clause.Query
 	Paging               *Paging
 	schema               *schema.Schema
-	upsert               bool //文档不存在时自动插入新文档
-	multiple             bool //强制批量更新
-	updateAndModifyModel bool //更新数据库成功时修改将最终结果写入到model
+	upsert               bool                     //文档不存在时自动插入新文档
+	multiple             bool                     //强制批量更新
+	updateAndModifyModel bool                     //更新数据库成功时修改将最终结果写入到model
+	allowDiskUse         bool                     //聚合时允许使用磁盘临时文件
+	elemMatch            map[string]clause.Filter //数组字段只返回第一个匹配的元素
+	returnDocument       options.ReturnDocument   //FindOneAndReplace 返回修改前或修改后的文档,默认修改后
+	hint                 any                      //强制使用索引,索引名称或者索引键 bson.D
+	collation            *options.Collation       //字符串比较规则
+	maxTime              time.Duration            //服务器端执行时间上限
+	unscoped             bool                     //忽略软删除,查询包含已删除文档,删除时物理删除
+	batchSize            int                      //批量写入时每批的数量
+	cursorBatchSize      int                      //游标每批从数据库读取的文档数量
+	textScore            string                   //全文检索相关度写入的字段,同时按相关度排序
+	orders               []bson.E                 //链式调用 Order 设置的排序
+	updateOrder          string                   //Paging.Update 使用的更新时间字段,排序时最先按照该字段倒序
+	merge                bool                     //SaveOrMerge,SetOnInsert 返回的字段只在插入时写入
+	unset                []string                 //更新时同时删除的字段
+	update               update.Update            //Update 生成的更新内容,用于日志
+	dryRunResult         *DryRunResult
+	client               *mongo.Client //本次操作使用的连接,Execute 时读取
+	writeConcern         *writeconcern.WriteConcern
+	readConcern          *readconcern.ReadConcern
 }
 
 // Parse Parse model to schema
@@ -43,6 +70,9 @@ func (stmt *Statement) Parse() (tx *DB) {
 	if tx.Error != nil {
 		return
 	}
+	if err := stmt.Clause.Err(); err != nil {
+		return tx.Errorf(err)
+	}
 	// assign value values
 	if stmt.value != nil {
 		stmt.reflectValue = reflect.ValueOf(stmt.value)
@@ -76,26 +106,205 @@ func (stmt *Statement) Parse() (tx *DB) {
 	return
 }
 
-// DBName 将对象字段转换成数据库字段
+// DBName 将对象字段转换成数据库字段,支持 Profile.Email 形式的嵌套路径
 func (stmt *Statement) DBName(name string) string {
+	return clause.DBName(stmt.schema, name)
+}
+
+// primaryValue model 或 value 为模型结构体时不为零值的主键,都没有时返回nil
+func (stmt *Statement) primaryValue() any {
 	if stmt.schema == nil {
-		return name
+		return nil
+	}
+	field := stmt.schema.LookUpField(clause.MongoPrimaryName)
+	if field == nil {
+		return nil
 	}
-	if field := stmt.schema.LookUpField(name); field != nil {
-		return field.DBName
+	for _, i := range []any{stmt.model, stmt.value} {
+		rv := reflect.Indirect(reflect.ValueOf(i))
+		if rv.Kind() != reflect.Struct || rv.Type() != stmt.schema.ModelType {
+			continue
+		}
+		if v := field.Get(rv); v.IsValid() && !v.IsZero() {
+			return v.Interface()
+		}
+	}
+	return nil
+}
+
+// now 当前时间,使用 Session.NowTime 设置的时钟,未设置时使用 time.Now
+func (stmt *Statement) now() time.Time {
+	if stmt.nowTime != nil {
+		return stmt.nowTime()
 	}
-	return name
+	return time.Now()
 }
 
-// Order 排序
+// textScoreMeta 全文检索相关度
+var textScoreMeta = bson.M{"$meta": "textScore"}
+
+// Order 排序,依次为 Paging.Update 更新时间,TextScore 相关度,Paging 中的排序和链式调用 Order 设置的排序
 func (stmt *Statement) Order() (order bson.D) {
-	for _, v := range stmt.Paging.order {
-		v.Key = stmt.DBName(v.Key)
-		order = append(order, v)
+	if stmt.updateOrder != "" {
+		order = append(order, bson.E{Key: stmt.updateOrder, Value: -1})
+	}
+	if stmt.textScore != "" {
+		order = append(order, bson.E{Key: stmt.textScore, Value: textScoreMeta})
+	}
+	for _, arr := range [][]bson.E{stmt.Paging.order, stmt.orders} {
+		for _, v := range arr {
+			v.Key = stmt.DBName(v.Key)
+			order = append(order, v)
+		}
 	}
 	return
 }
 
+// Projection 查询返回的字段,合并 Select,Omit,ElemMatchProject 和 TextScore
+func (stmt *Statement) Projection() bson.M {
+	r := bson.M{}
+	for k, v := range stmt.selector.Projection(stmt.schema) {
+		r[k] = v
+	}
+	for k, v := range stmt.elemMatch {
+		r[stmt.DBName(k)] = bson.M{"$elemMatch": v}
+	}
+	if stmt.textScore != "" {
+		r[stmt.textScore] = textScoreMeta
+	}
+	return r
+}
+
+// collection 当前操作的集合,使用 WriteConcern,ReadConcern 的设置
+func (stmt *Statement) collection() *mongo.Collection {
+	return stmt.client.Database(stmt.dbname).Collection(stmt.table, stmt.collectionOptions())
+}
+
+// collectionOptions 集合选项,事务中驱动忽略集合的 WriteConcern,ReadConcern,使用事务的设置
+func (stmt *Statement) collectionOptions() *options.CollectionOptions {
+	opts := options.Collection()
+	if stmt.writeConcern != nil {
+		opts.SetWriteConcern(stmt.writeConcern)
+	}
+	if stmt.readConcern != nil {
+		opts.SetReadConcern(stmt.readConcern)
+	}
+	return opts
+}
+
+// findOptions 查询多条记录的选项
+func (stmt *Statement) findOptions() *options.FindOptions {
+	opts := options.Find()
+	if stmt.Paging.Size > 0 {
+		opts.SetLimit(int64(stmt.Paging.Size))
+	}
+	if offset := stmt.Paging.Offset(); offset > 0 {
+		opts.SetSkip(int64(offset))
+	}
+	if order := stmt.Order(); len(order) > 0 {
+		opts.SetSort(order)
+	}
+	if projection := stmt.Projection(); len(projection) > 0 {
+		opts.SetProjection(projection)
+	}
+	if stmt.hint != nil {
+		opts.SetHint(stmt.hint)
+	}
+	if stmt.collation != nil {
+		opts.SetCollation(stmt.collation)
+	}
+	if stmt.maxTime > 0 {
+		opts.SetMaxTime(stmt.maxTime)
+	}
+	if n := stmt.cursorBatchSize; n > 0 {
+		//超过 limit 时只需要一批
+		if stmt.Paging.Size > 0 && n > stmt.Paging.Size {
+			n = stmt.Paging.Size
+		}
+		opts.SetBatchSize(int32(n))
+	}
+	return opts
+}
+
+// findOneOptions 查询单条记录的选项
+func (stmt *Statement) findOneOptions() *options.FindOneOptions {
+	opts := options.FindOne()
+	if offset := stmt.Paging.Offset(); offset > 0 {
+		opts.SetSkip(int64(offset))
+	}
+	if order := stmt.Order(); len(order) > 0 {
+		opts.SetSort(order)
+	}
+	if projection := stmt.Projection(); len(projection) > 0 {
+		opts.SetProjection(projection)
+	}
+	if stmt.hint != nil {
+		opts.SetHint(stmt.hint)
+	}
+	if stmt.collation != nil {
+		opts.SetCollation(stmt.collation)
+	}
+	if stmt.maxTime > 0 {
+		opts.SetMaxTime(stmt.maxTime)
+	}
+	return opts
+}
+
+// countOptions 统计文档数的选项
+func (stmt *Statement) countOptions() *options.CountOptions {
+	opts := options.Count()
+	if stmt.hint != nil {
+		opts.SetHint(stmt.hint)
+	}
+	if stmt.collation != nil {
+		opts.SetCollation(stmt.collation)
+	}
+	if stmt.maxTime > 0 {
+		opts.SetMaxTime(stmt.maxTime)
+	}
+	return opts
+}
+
+// softDeleteField 软删除标记字段,未启用或者 Unscoped 时返回nil
+func (stmt *Statement) softDeleteField() *schema.Field {
+	if stmt.unscoped {
+		return nil
+	}
+	field := LookUpTagField(stmt.schema, TagSoftDelete)
+	if field == nil {
+		return nil
+	}
+	if _, ok := softDeleteValue(field, stmt.now()); !ok {
+		return nil
+	}
+	return field
+}
+
+// scoped 启用软删除时排除已删除的文档,查询条件中已经包含标记字段时不做处理
+func (stmt *Statement) scoped(filter clause.Filter) clause.Filter {
+	if field := stmt.softDeleteField(); field != nil {
+		if _, ok := filter[field.DBName]; !ok {
+			//未删除的文档中标记字段不存在(null)或者为零值
+			filter[field.DBName] = bson.M{"$in": bson.A{nil, reflect.Zero(field.IndirectFieldType).Interface()}}
+		}
+	}
+	return filter
+}
+
+// Filter 查询条件,启用软删除时自动排除已删除的文档
+func (stmt *Statement) Filter() clause.Filter {
+	return stmt.scoped(stmt.Clause.Build(stmt.schema))
+}
+
+// maxTimeContext UpdateOptions 不支持 maxTimeMS,使用 MaxTime 作为超时时间派生 Context
+// 和调用方 Context 的 deadline 同时生效,以先到者为准
+func (stmt *Statement) maxTimeContext() (context.Context, context.CancelFunc) {
+	if stmt.maxTime > 0 {
+		return context.WithTimeout(stmt.Context, stmt.maxTime)
+	}
+	return stmt.Context, func() {}
+}
+
 func (stmt *Statement) Schema() *schema.Schema {
 	return stmt.schema
 }
@@ -0,0 +1,45 @@
+package cosmo
+
+import (
+	"github.com/hwcer/cosgo/schema"
+)
+
+// TagName 字段设置标签,多个设置使用逗号分隔
+//
+//	Version int64 `bson:"version" cosmo:"version"`
+//	Created int64 `bson:"created" cosmo:"autoCreateTime"`
+//	Updated time.Time `bson:"updated" cosmo:"autoUpdateTime"`
+//	Deleted int64 `bson:"deleted" cosmo:"softDelete"`
+//	Status string `bson:"status" cosmo:"default:active"`
+const TagName = "cosmo"
+
+const (
+	TagVersion        = "VERSION"        //乐观锁版本号
+	TagAutoCreateTime = "AUTOCREATETIME" //创建时自动写入当前时间
+	TagAutoUpdateTime = "AUTOUPDATETIME" //创建和更新时自动写入当前时间
+	TagSoftDelete     = "SOFTDELETE"     //软删除标记,支持 time.Time,整数(unix 秒)和 bool
+	TagDefault        = "DEFAULT"        //创建时零值字段的默认值,支持字符串,布尔和数字
+)
+
+// TagSettings 解析字段的 cosmo 标签
+func TagSettings(field *schema.Field) map[string]string {
+	tag, ok := field.StructField.Tag.Lookup(TagName)
+	if !ok {
+		return nil
+	}
+	return schema.ParseTagSetting(tag, ",")
+}
+
+// LookUpTagField 查找设置了指定标签的字段
+func LookUpTagField(sch *schema.Schema, key string) (r *schema.Field) {
+	if sch == nil {
+		return nil
+	}
+	sch.Range(func(field *schema.Field) bool {
+		if _, ok := TagSettings(field)[key]; ok {
+			r = field
+		}
+		return r == nil
+	})
+	return
+}
@@ -12,6 +12,8 @@ import (
 
 const MongodbFieldSplit = "."
 
+// SetOnInsert 使用Struct更新时返回只在插入时写入的字段,可以使用对象字段名或数据库字段名
+// 字段同时为非零值时使用 $set,需要只在插入时写入请使用 cosmo.SaveOrMerge
 type SetOnInsert interface {
 	SetOnInsert() (map[string]any, error)
 }
@@ -70,6 +72,9 @@ func parseMap(desc interface{}, reflectValue reflect.Value, sch *schema.Schema,
 	return update.Transform(sch), nil
 }
 
+// parseStruct 使用Struct的非零值字段生成 $set
+// 匿名嵌入的结构体需要使用 `bson:",inline"` 标签,其字段展开到顶层,与 mongo driver 的编码一致
+// 外层结构体与嵌入结构体有同名字段时外层字段优先,多层嵌入时层级浅的优先
 func parseStruct(desc interface{}, reflectValue reflect.Value, sch *schema.Schema, filter *Selector) (update Update, err error) {
 	defer func() {
 		if e := recover(); e != nil {
@@ -82,21 +87,41 @@ func parseStruct(desc interface{}, reflectValue reflect.Value, sch *schema.Schem
 		if k == clause.MongoPrimaryName {
 			return true
 		}
-		v := reflectValue.FieldByIndex(field.Index)
-		if filter.Has(k) && v.IsValid() && !v.IsZero() {
+		v := fieldValue(reflectValue, field.Index)
+		if filter.HasField(field) && v.IsValid() && !v.IsZero() {
 			update.Set(k, v.Interface())
 		}
 		return true
 	})
 	if s, ok := desc.(SetOnInsert); ok {
 		var v map[string]interface{}
-		if v, err = s.SetOnInsert(); err == nil && len(v) > 0 {
-			update[UpdateTypeSetOnInsert] = v
+		if v, err = s.SetOnInsert(); err == nil {
+			for k, i := range v {
+				update.SetOnInert(clause.DBName(sch, k), i)
+			}
 		}
 	}
 	return
 }
 
+// fieldValue 读取字段值,支持 schema 中匿名嵌入结构体(包括指针)展开的字段
+// 嵌入的指针为nil时返回无效值,不会创建对象
+func fieldValue(v reflect.Value, index []int) reflect.Value {
+	for _, i := range index {
+		if i < 0 {
+			i = -i - 1
+		}
+		for v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}
+			}
+			v = v.Elem()
+		}
+		v = v.Field(i)
+	}
+	return v
+}
+
 func filterSetOnInsert(data map[string]interface{}, update Update) map[string]interface{} {
 	r := map[string]interface{}{}
 	keys := update.Projection()
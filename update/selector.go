@@ -2,6 +2,7 @@ package update
 
 import (
 	"github.com/hwcer/cosgo/schema"
+	"github.com/hwcer/cosmo/clause"
 )
 
 type SelectorType int8
@@ -30,6 +31,33 @@ func (this *Selector) Has(key string) bool {
 	}
 }
 
+// HasField 字段是否被选择,Select,Omit 中使用对象字段名或数据库字段名都可以匹配
+func (this *Selector) HasField(field *schema.Field) bool {
+	if this.projection == nil {
+		return true
+	}
+	_, ok := this.projection[field.DBName]
+	if !ok {
+		_, ok = this.projection[field.Name]
+	}
+	if this.selector == SelectorTypeOmit {
+		return !ok
+	}
+	return ok
+}
+
+// Clone 复制 Select,Omit 设置的字段
+func (this *Selector) Clone() Selector {
+	r := Selector{selector: this.selector}
+	if this.projection != nil {
+		r.projection = make(map[string]bool, len(this.projection))
+		for k, v := range this.projection {
+			r.projection[k] = v
+		}
+	}
+	return r
+}
+
 func (this *Selector) Release() {
 	this.selector = SelectorTypeNone
 	this.projection = nil
@@ -65,18 +93,15 @@ func (this *Selector) Omit(columns ...string) bool {
 	return true
 }
 
-// Projection 获取字段,如果sch!=nil && this.selector == SelectorTypeOmit 全部翻转成 Select模式
-// FindOneAndUpdate 时有用,其他模式传nil
+// Projection 获取字段,Select,Omit 中可以使用对象字段名或数据库字段名,统一转换成数据库字段名
+// sch 为nil(使用 Table 没有模型)或者无法解析的字段保持原样,支持使用 . 分隔的嵌套字段
 func (this *Selector) Projection(sch *schema.Schema) map[string]bool {
 	if this.projection == nil {
 		return nil
 	}
 	r := map[string]bool{}
 	for k, v := range this.projection {
-		if field := sch.LookUpField(k); field != nil {
-			r[field.DBName] = v
-		}
+		r[clause.DBName(sch, k)] = v
 	}
-
 	return r
 }
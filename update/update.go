@@ -3,6 +3,7 @@ package update
 import (
 	"encoding/json"
 	"github.com/hwcer/cosgo/schema"
+	"github.com/hwcer/cosmo/clause"
 	"github.com/hwcer/cosmo/utils"
 	"go.mongodb.org/mongo-driver/bson"
 	"strings"
@@ -13,8 +14,17 @@ const (
 	UpdateTypeInc         = "$inc"
 	UpdateTypeUnset       = "$unset"
 	UpdateTypeSetOnInsert = "$setOnInsert"
+	UpdateTypeAddToSet    = "$addToSet"
+	UpdateTypePullAll     = "$pullAll"
+	UpdateTypePush        = "$push"
+	UpdateTypeRename      = "$rename"
+	UpdateTypeMul         = "$mul"
+	UpdateTypeCurrentDate = "$currentDate"
 )
 
+// transformTypes Transform 时需要转换字段名的操作
+var transformTypes = []string{UpdateTypeSet, UpdateTypeInc, UpdateTypeUnset, UpdateTypeSetOnInsert, UpdateTypeAddToSet, UpdateTypePullAll, UpdateTypePush, UpdateTypeRename, UpdateTypeMul, UpdateTypeCurrentDate, "$pull", "$pop", "$min", "$max"}
+
 var projectionField = []string{UpdateTypeSet, UpdateTypeInc}
 
 func New() Update {
@@ -84,7 +94,76 @@ func (u Update) Pull(k string, v interface{}) {
 }
 
 func (u Update) Push(k string, v interface{}) {
-	u.Any("$push", k, v)
+	u.Any(UpdateTypePush, k, v)
+}
+
+// Rename 字段改名
+func (u Update) Rename(from, to string) {
+	u.Any(UpdateTypeRename, from, to)
+}
+
+// Mul 字段乘以v
+func (u Update) Mul(k string, v interface{}) {
+	u.Any(UpdateTypeMul, k, v)
+}
+
+// CurrentDate 字段设置为数据库当前时间,typ 为 "date"(默认) 或 "timestamp"
+func (u Update) CurrentDate(k string, typ string) {
+	if typ == "" || typ == "date" {
+		u.Any(UpdateTypeCurrentDate, k, true)
+	} else {
+		u.Any(UpdateTypeCurrentDate, k, bson.M{"$type": typ})
+	}
+}
+
+// PushOption PushEach 的修饰符
+type PushOption func(bson.M)
+
+// Slice 写入后只保留数组前n个元素,n<0 时保留最后|n|个
+func Slice(n int) PushOption {
+	return func(m bson.M) {
+		m["$slice"] = n
+	}
+}
+
+// Sort 写入后对数组排序,spec 为 1,-1 或者 bson.D{{"score",-1}}
+func Sort(spec interface{}) PushOption {
+	return func(m bson.M) {
+		m["$sort"] = spec
+	}
+}
+
+// Position 插入位置,默认追加到末尾
+func Position(n int) PushOption {
+	return func(m bson.M) {
+		m["$position"] = n
+	}
+}
+
+// PushEach 将values中的元素逐个写入数组,values 为Slice
+//
+//	u.PushEach("logs", logs, update.Slice(-100)) //只保留最近100条
+func (u Update) PushEach(k string, values interface{}, opts ...PushOption) {
+	v := bson.M{"$each": values}
+	for _, f := range opts {
+		f(v)
+	}
+	u.Any(UpdateTypePush, k, v)
+}
+
+// AddToSet 值不存在时加入数组
+func (u Update) AddToSet(k string, v interface{}) {
+	u.Any(UpdateTypeAddToSet, k, v)
+}
+
+// AddToSetEach 将values中不存在的值逐个加入数组,values 为Slice
+func (u Update) AddToSetEach(k string, values interface{}) {
+	u.Any(UpdateTypeAddToSet, k, bson.M{"$each": values})
+}
+
+// PullAll 从数组中删除values中的所有值,values 为Slice
+func (u Update) PullAll(k string, values interface{}) {
+	u.Any(UpdateTypePullAll, k, values)
 }
 
 func (u Update) Any(t, k string, v interface{}) {
@@ -139,14 +218,21 @@ func (u Update) Projection() bson.M {
 }
 
 // Transform 转换成数据库字段名
+// $rename 的值为新字段名,同样进行转换
+// $rename 和 $unset 常用于处理已经从模型中移除的字段,无法转换时保持原样
 func (u Update) Transform(sch *schema.Schema) Update {
 	r := Update{}
-	for _, t := range []string{UpdateTypeSet, UpdateTypeInc, UpdateTypeUnset, UpdateTypeSetOnInsert} {
+	for _, t := range transformTypes {
 		if m, ok := u[t]; ok {
 			d := bson.M{}
 			for k, v := range m {
-				if strings.Contains(k, MongodbFieldSplit) {
-					d[k] = v
+				if t == UpdateTypeRename {
+					if s, ok := v.(string); ok {
+						v = clause.DBName(sch, s)
+					}
+				}
+				if strings.Contains(k, MongodbFieldSplit) || t == UpdateTypeRename || t == UpdateTypeUnset {
+					d[clause.DBName(sch, k)] = v
 				} else if field := sch.LookUpField(k); field != nil {
 					d[field.DBName] = v
 				}
@@ -0,0 +1,220 @@
+package update
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hwcer/cosgo/schema"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type testModel struct {
+	Id   int      `bson:"_id"`
+	Name string   `bson:"name"`
+	Tags []string `bson:"tags"`
+	Lv   int      `bson:"lv"`
+}
+
+func testSchema(t *testing.T) *schema.Schema {
+	sch, err := schema.Parse(&testModel{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sch
+}
+
+func TestAddToSet(t *testing.T) {
+	u := New()
+	u.AddToSet("Tags", "a")
+	u.PullAll("tags", []string{"b", "c"})
+	want := Update{
+		UpdateTypeAddToSet: bson.M{"tags": "a"},
+		UpdateTypePullAll:  bson.M{"tags": []string{"b", "c"}},
+	}
+	if r := u.Transform(testSchema(t)); !reflect.DeepEqual(r, want) {
+		t.Fatalf("AddToSet error:%v", r)
+	}
+	u = New()
+	u.AddToSetEach("Tags", []string{"a", "b"})
+	want = Update{UpdateTypeAddToSet: bson.M{"tags": bson.M{"$each": []string{"a", "b"}}}}
+	if r := u.Transform(testSchema(t)); !reflect.DeepEqual(r, want) {
+		t.Fatalf("AddToSetEach error:%v", r)
+	}
+}
+
+func TestPushEach(t *testing.T) {
+	u := New()
+	u.PushEach("Tags", []string{"a", "b"})
+	want := Update{UpdateTypePush: bson.M{"tags": bson.M{"$each": []string{"a", "b"}}}}
+	if r := u.Transform(testSchema(t)); !reflect.DeepEqual(r, want) {
+		t.Fatalf("PushEach error:%v", r)
+	}
+	u = New()
+	u.PushEach("tags", []string{"c"}, Slice(-10), Sort(1), Position(0))
+	want = Update{UpdateTypePush: bson.M{"tags": bson.M{"$each": []string{"c"}, "$slice": -10, "$sort": 1, "$position": 0}}}
+	if r := u.Transform(testSchema(t)); !reflect.DeepEqual(r, want) {
+		t.Fatalf("PushEach with modifiers error:%v", r)
+	}
+}
+
+func TestOperators(t *testing.T) {
+	u := New()
+	u.Rename("Name", "Lv")
+	u.Mul("Lv", 2)
+	u.CurrentDate("name", "")
+	u.CurrentDate("Lv", "timestamp")
+	want := Update{
+		UpdateTypeRename:      bson.M{"name": "lv"},
+		UpdateTypeMul:         bson.M{"lv": 2},
+		UpdateTypeCurrentDate: bson.M{"name": true, "lv": bson.M{"$type": "timestamp"}},
+	}
+	if r := u.Transform(testSchema(t)); !reflect.DeepEqual(r, want) {
+		t.Fatalf("operators error:%v", r)
+	}
+	//新字段名不在模型中时保持原样
+	u = New()
+	u.Rename("name", "nickname")
+	if r := u.Transform(testSchema(t)); !reflect.DeepEqual(r, Update{UpdateTypeRename: bson.M{"name": "nickname"}}) {
+		t.Fatalf("Rename error:%v", r)
+	}
+	//模型中已经移除的字段
+	u = New()
+	u.Rename("oldName", "Name")
+	u.Unset("oldLv")
+	want = Update{UpdateTypeRename: bson.M{"oldName": "name"}, UpdateTypeUnset: bson.M{"oldLv": 1}}
+	if r := u.Transform(testSchema(t)); !reflect.DeepEqual(r, want) {
+		t.Fatalf("Rename and Unset unknown field = %v, want %v", r, want)
+	}
+}
+
+type testAddress struct {
+	City string `bson:"city"`
+}
+
+type testProfile struct {
+	Age     int         `bson:"age"`
+	Address testAddress `bson:"addr"`
+}
+
+type testNested struct {
+	Id      int         `bson:"_id"`
+	Profile testProfile `bson:"profile"`
+}
+
+func TestTransformNested(t *testing.T) {
+	sch, err := schema.Parse(&testNested{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := New()
+	u.Set("Profile.Address.City", "sz")
+	u.Inc("profile.Age", 1)
+	u.Set("Profile.Unknown.X", 1)
+	u.Rename("Profile.Age", "Profile.Address.City")
+	want := Update{
+		UpdateTypeSet:    bson.M{"profile.addr.city": "sz", "profile.Unknown.X": 1},
+		UpdateTypeInc:    bson.M{"profile.age": 1},
+		UpdateTypeRename: bson.M{"profile.age": "profile.addr.city"},
+	}
+	if r := u.Transform(sch); !reflect.DeepEqual(r, want) {
+		t.Fatalf("nested Transform = %v, want %v", r, want)
+	}
+}
+
+type TestInlineTime struct {
+	Created int64 `bson:"created"`
+	Updated int64 `bson:"updated"`
+}
+
+type TestInlineBase struct {
+	Id             int `bson:"_id"`
+	TestInlineTime `bson:",inline"`
+	Name           string `bson:"base_name"`
+}
+
+type testInlineRole struct {
+	TestInlineBase `bson:",inline"`
+	Name           string `bson:"name"`
+	Lv             int    `bson:"lv"`
+}
+
+type testInlinePtr struct {
+	*TestInlineBase `bson:",inline"`
+	Lv              int `bson:"lv"`
+}
+
+func TestBuildInline(t *testing.T) {
+	sch, err := schema.Parse(&testInlineRole{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f := sch.LookUpField("Created"); f == nil || f.DBName != "created" {
+		t.Fatalf("nested inline field error:%v", f)
+	}
+	//外层 Name 覆盖嵌入结构体中的 Name
+	if f := sch.LookUpField("Name"); f == nil || f.DBName != "name" {
+		t.Fatalf("conflict field should use outer struct:%v", f)
+	}
+	role := &testInlineRole{Name: "hwc", Lv: 2}
+	role.Id = 1
+	role.Created = 100
+	up, _, err := Build(role, sch, &Selector{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Update{UpdateTypeSet: {"name": "hwc", "lv": 2, "created": int64(100)}}
+	if !reflect.DeepEqual(up, want) {
+		t.Fatalf("inline Build = %v, want %v", up, want)
+	}
+
+	sch, err = schema.Parse(&testInlinePtr{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if up, _, err = Build(&testInlinePtr{Lv: 3}, sch, &Selector{}); err != nil || !reflect.DeepEqual(up, Update{UpdateTypeSet: {"lv": 3}}) {
+		t.Fatalf("nil inline pointer Build = %v,%v", up, err)
+	}
+	ptr := &testInlinePtr{TestInlineBase: &TestInlineBase{Name: "base"}}
+	ptr.Updated = 200
+	if up, _, err = Build(ptr, sch, &Selector{}); err != nil || !reflect.DeepEqual(up, Update{UpdateTypeSet: {"base_name": "base", "updated": int64(200)}}) {
+		t.Fatalf("inline pointer Build = %v,%v", up, err)
+	}
+}
+
+func TestSelectorProjection(t *testing.T) {
+	sch := testSchema(t)
+	s := &Selector{}
+	s.Select("Name", "lv", "extra.key")
+	want := map[string]bool{"name": true, "lv": true, "extra.key": true}
+	if r := s.Projection(sch); !reflect.DeepEqual(r, want) {
+		t.Fatalf("Projection error:%v", r)
+	}
+	//没有模型时保持原样
+	s = &Selector{}
+	s.Omit("name")
+	if r := s.Projection(nil); !reflect.DeepEqual(r, map[string]bool{"name": false}) {
+		t.Fatalf("Projection without schema error:%v", r)
+	}
+}
+
+func TestBuildSelector(t *testing.T) {
+	sch := testSchema(t)
+	val := &testModel{Id: 1, Name: "a", Lv: 2}
+	s := &Selector{}
+	s.Select("Name")
+	u, _, err := Build(val, sch, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Update{UpdateTypeSet: {"name": "a"}}); !reflect.DeepEqual(u, want) {
+		t.Fatalf("Build with Select error:%v", u)
+	}
+	s = &Selector{}
+	s.Omit("name")
+	if u, _, err = Build(val, sch, s); err != nil {
+		t.Fatal(err)
+	}
+	if want := (Update{UpdateTypeSet: {"lv": 2}}); !reflect.DeepEqual(u, want) {
+		t.Fatalf("Build with Omit error:%v", u)
+	}
+}
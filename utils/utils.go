@@ -5,6 +5,7 @@ import (
 
 	"fmt"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"reflect"
 	"regexp"
 	"runtime"
@@ -40,17 +41,39 @@ func ValueOf(i interface{}) reflect.Value {
 	return value
 }
 
+// ToArray 转换成 $in,$nin 使用的一维数组
+// 非数组的值作为单个元素,数组中的元素如果也是数组则展开一层
+// 例如 []int{1,2} 和 []interface{}{[]int{1,2}} 都得到 [1,2]
+// string,[]byte 和 ObjectID 等字节数组作为单个值
 func ToArray(v interface{}) (r []interface{}) {
 	vf := reflect.Indirect(reflect.ValueOf(v))
-	if vf.Kind() != reflect.Array && vf.Kind() != reflect.Slice {
+	if !IsArray(vf) {
 		return []interface{}{v}
 	}
 	for i := 0; i < vf.Len(); i++ {
-		r = append(r, vf.Index(i).Interface())
+		item := vf.Index(i)
+		if item.Kind() == reflect.Interface {
+			item = item.Elem()
+		}
+		if sub := reflect.Indirect(item); IsArray(sub) {
+			for j := 0; j < sub.Len(); j++ {
+				r = append(r, sub.Index(j).Interface())
+			}
+		} else {
+			r = append(r, vf.Index(i).Interface())
+		}
 	}
 	return
 }
 
+// IsArray 是否作为多个值的数组,[]byte 和 ObjectID 作为单个值
+func IsArray(vf reflect.Value) bool {
+	if vf.Kind() != reflect.Array && vf.Kind() != reflect.Slice {
+		return false
+	}
+	return vf.Type().Elem().Kind() != reflect.Uint8
+}
+
 // FileWithLineNum return the file name and line number of the current file
 func FileWithLineNum() string {
 	// the second caller usually from gorm internal, so set i start from 2
@@ -125,6 +148,7 @@ func AssertEqual(src, dst interface{}) bool {
 	return true
 }
 
+// ToString 转换成字符串,数字和布尔使用 strconv,ObjectID 使用 Hex,其他类型使用 fmt.Sprint,nil 返回空字符串
 func ToString(value interface{}) string {
 	switch v := value.(type) {
 	case string:
@@ -149,6 +173,20 @@ func ToString(value interface{}) string {
 		return strconv.FormatUint(uint64(v), 10)
 	case uint64:
 		return strconv.FormatUint(v, 10)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case []byte:
+		return string(v)
+	case primitive.ObjectID:
+		return v.Hex()
+	case fmt.Stringer:
+		return v.String()
+	case nil:
+		return ""
 	}
-	return ""
+	return fmt.Sprint(value)
 }
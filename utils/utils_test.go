@@ -1,8 +1,11 @@
 package utils
 
 import (
+	"reflect"
 	"strings"
 	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 func TestIsValidDBNameChar(t *testing.T) {
@@ -25,3 +28,59 @@ func TestToBson(t *testing.T) {
 	}
 
 }
+
+func TestToArray(t *testing.T) {
+	want := []interface{}{1, 2}
+	oid := primitive.NewObjectID()
+	cases := []struct {
+		v    interface{}
+		want []interface{}
+	}{
+		{1, []interface{}{1}},
+		{[]int{1, 2}, want},
+		{&[]int{1, 2}, want},
+		{[]interface{}{1, 2}, want},
+		{[]interface{}{[]int{1, 2}}, want},
+		{[]interface{}{[]interface{}{1}, 2}, want},
+		{[]string{"a", "b"}, []interface{}{"a", "b"}},
+		{[]interface{}{[]string{"a", "b"}}, []interface{}{"a", "b"}},
+		{[]primitive.ObjectID{oid}, []interface{}{oid}},
+		{[]interface{}{oid}, []interface{}{oid}},
+		{oid, []interface{}{oid}},
+		{"abc", []interface{}{"abc"}},
+		{[]byte("abc"), []interface{}{[]byte("abc")}},
+		{[][]byte{[]byte("a"), []byte("b")}, []interface{}{[]byte("a"), []byte("b")}},
+	}
+	for _, c := range cases {
+		if r := ToArray(c.v); !reflect.DeepEqual(r, c.want) {
+			t.Fatalf("ToArray(%v) = %v, want %v", c.v, r, c.want)
+		}
+	}
+}
+
+type testStringer struct{ Id int }
+
+func TestToString(t *testing.T) {
+	oid := primitive.NewObjectID()
+	cases := []struct {
+		v    interface{}
+		want string
+	}{
+		{"a", "a"},
+		{-12, "-12"},
+		{uint8(7), "7"},
+		{float32(1.5), "1.5"},
+		{0.1, "0.1"},
+		{float64(100), "100"},
+		{true, "true"},
+		{[]byte("ab"), "ab"},
+		{oid, oid.Hex()},
+		{testStringer{Id: 1}, "{1}"},
+		{nil, ""},
+	}
+	for _, c := range cases {
+		if s := ToString(c.v); s != c.want {
+			t.Fatalf("ToString(%#v) = %q, want %q", c.v, s, c.want)
+		}
+	}
+}